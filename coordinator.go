@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"localhost/flobrm/tilingsolver/tileio"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// runCoordinator implements the coordinator subcommand. It hands out the jobs of the input file to solver processes
+// started with -coordinator, and writes the statuses and solutions they report to output_dir. It runs until it gets
+// SIGINT or SIGTERM. The queue and the leases are only kept in memory, jobs that are leased at that moment have to be
+// solved again.
+func runCoordinator(args []string) {
+	fs := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	inputFile := fs.String("input_file", "", "File with the puzzles/jobs to hand out")
+	outputDir := fs.String("output_dir", "", "Directory where the status and solutions files go")
+	name := fs.String("name", "coordinator", "Name of the status and solutions files, like processID for solvers")
+	address := fs.String("address", ":8080", "Address the coordinator listens on")
+	leaseTime := fs.Int("lease_time", 60, "Seconds a solver has to renew the lease of a job, before the job is handed out again")
+	strict := fs.Bool("strict_input", false, "Stop handing out new jobs at the first input row that can't be read, instead of skipping it")
+	rejectFile := fs.String("reject_file", "", "Write input rows that are skipped to this csv file with their line number and the reason, instead of the log")
+	fs.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("coordinator needs an -input_file")
+	}
+	if *leaseTime <= 0 {
+		log.Fatal("-lease_time must be positive")
+	}
+	results, err := tileio.NewPuzzleCSVWriter(fmt.Sprintf("%s/%s.status.csv", *outputDir, *name),
+		fmt.Sprintf("%s/%s.solutions.csv", *outputDir, *name))
+	if err != nil {
+		log.Fatal("Could not open output files: ", err)
+	}
+	defer results.Close()
+	inputOpts, closeRejects := readerOptions(*strict, *rejectFile)
+	defer closeRejects()
+	input, err := tileio.NewPuzzleCSVReader(*inputFile, inputOpts)
+	if err != nil {
+		log.Fatal("Could not open input file: ", err)
+	}
+	coordinator := tileio.NewJobCoordinator(input, results, time.Duration(*leaseTime)*time.Second)
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		log.Fatal("Couldn't listen: ", err)
+	}
+	server := &http.Server{Handler: coordinator}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Coordinator stopped: ", err)
+		}
+	}()
+	log.Println("Handing out jobs on", listener.Addr())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopSignals := cancelOnSignal(cancel)
+	defer stopSignals()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	done := false
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case now := <-ticker.C:
+			coordinator.ExpireLeases(now)
+			if !done && coordinator.Done() {
+				done = true
+				log.Println("All jobs are finished")
+			}
+		}
+	}
+	// let requests in progress finish, so their results are written
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	server.Shutdown(shutdownCtx)
+}
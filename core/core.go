@@ -12,3 +12,12 @@ type TilePlacement struct {
 	Idx int  //Tile index
 	Rot bool //false is flat, true is upright
 }
+
+//Puzzle is a tiling puzzle, or a job covering part of its search when Start or End are set
+type Puzzle struct {
+	Board     Coord
+	Tiles     []Coord
+	Rotations []Rotation      //rotation policy of each tile, nil if all tiles are free
+	Start     []TilePlacement //where the search starts, nil for the beginning
+	End       []TilePlacement //where the search stops, nil for the end
+}
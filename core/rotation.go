@@ -0,0 +1,72 @@
+package core
+
+import "fmt"
+
+//Rotation restricts the ways a tile can be placed, flat and upright mean the same as in TilePlacement.Rot
+type Rotation int
+
+//Rotation policies, the zero value lets a tile be placed both ways
+const (
+	RotationFree    Rotation = iota //flat or upright
+	RotationFlat                    //only flat, with X along the width of the board
+	RotationUpright                 //only upright, with X along the height of the board
+)
+
+var rotationNames = map[Rotation]string{
+	RotationFree:    "free",
+	RotationFlat:    "flat",
+	RotationUpright: "upright",
+}
+
+//Allows returns whether a tile with this policy can be placed upright, or flat if upright is false
+func (r Rotation) Allows(upright bool) bool {
+	switch r {
+	case RotationFlat:
+		return !upright
+	case RotationUpright:
+		return upright
+	}
+	return true
+}
+
+//Transposed returns the policy on a board with its width and height swapped, where flat and upright trade places
+func (r Rotation) Transposed() Rotation {
+	switch r {
+	case RotationFlat:
+		return RotationUpright
+	case RotationUpright:
+		return RotationFlat
+	}
+	return r
+}
+
+func (r Rotation) String() string {
+	if name, ok := rotationNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Rotation(%d)", int(r))
+}
+
+//MarshalText encodes the policy by name, so it reads as "free", "flat" or "upright" in json
+func (r Rotation) MarshalText() ([]byte, error) {
+	name, ok := rotationNames[r]
+	if !ok {
+		return nil, fmt.Errorf("unknown rotation %d", int(r))
+	}
+	return []byte(name), nil
+}
+
+//UnmarshalText decodes a policy by name, an empty name is free
+func (r *Rotation) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*r = RotationFree
+		return nil
+	}
+	for rotation, name := range rotationNames {
+		if name == string(text) {
+			*r = rotation
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rotation %q, expected free, flat or upright", text)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"io"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runEstimate implements the estimate subcommand. For every puzzle or job in the input it estimates how many tiles
+// the search places with random probes, and how long that takes from the speed of a short calibration run. The
+// estimates are written as csv, one row per job.
+func runEstimate(args []string) {
+	fs := flag.NewFlagSet("estimate", flag.ExitOnError)
+	inputFile := fs.String("input_file", "", "File with the puzzles/jobs to estimate")
+	outputFile := fs.String("output_file", "", "File the estimates are written to, stdout if empty")
+	probes := fs.Int("probes", 1000, "Number of random probes per job, the confidence interval shrinks with the square root of this")
+	seed := fs.Int64("seed", 1, "Seed of the random probes")
+	calibrateTime := fs.Int("calibrate_time", 1, "Seconds each job is searched to measure the speed of the solver, 0 disables this")
+	nodesPerSecond := fs.Float64("nodes_per_second", 0, "Speed of the solver in tiles placed per second, instead of calibrating it")
+	opts := tiling.DefaultOptions()
+	opts.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("estimate needs an -input_file")
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatal("Invalid solver options: ", err)
+	}
+	opts.CountOnly = true
+	opts.StopOnSolution = false
+
+	output := os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			log.Fatal("Could not open output file: ", err)
+		}
+		defer file.Close()
+		output = file
+	}
+	writer := csv.NewWriter(output)
+	writer.Write([]string{"job_id", "puzzle_id", "probes", "tiles_placed", "tiles_placed_low", "tiles_placed_high",
+		"exact", "nodes_per_second", "duration", "duration_low", "duration_high"})
+	rng := rand.New(rand.NewSource(*seed))
+	reader, err := tileio.NewPuzzleCSVReader(*inputFile, tileio.ReaderOptions{})
+	if err != nil {
+		log.Fatal("Could not open input file: ", err)
+	}
+	for job, err := reader.NextPuzzle(); err != io.EOF; job, err = reader.NextPuzzle() {
+		if err != nil {
+			log.Fatal(err)
+		}
+		puzzle := job.Puzzle()
+		if err := tiling.Presolve(puzzle); err != nil { //the solver won't search it at all
+			log.Println("Job", job.JobID, "is infeasible:", err)
+			writer.Write([]string{strconv.Itoa(job.JobID), strconv.Itoa(job.PuzzleID), "0", "0", "0", "0", "true",
+				"", "0", "0", "0"})
+			writer.Flush()
+			continue
+		}
+		estimate, err := tiling.EstimateSearch(context.Background(), puzzle, opts, *probes, rng)
+		if err != nil {
+			log.Fatal("Couldn't estimate job ", job.JobID, ": ", err)
+		}
+
+		rate, exact := *nodesPerSecond, false
+		if rate <= 0 && *calibrateTime > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*calibrateTime)*time.Second)
+			calibrateStart := time.Now()
+			result, err := tiling.NaiveSolver{}.Solve(ctx, puzzle, opts, nil, tiling.Progress{})
+			elapsed := time.Since(calibrateStart)
+			cancel()
+			if err != nil {
+				log.Fatal("Couldn't calibrate job ", job.JobID, ": ", err)
+			}
+			rate = float64(result.TilesPlaced) / elapsed.Seconds()
+			if result.Status == "solved" { //the calibration searched the whole job, so the size is known
+				exact = true
+				estimate.TilesPlaced = float64(result.TilesPlaced)
+				estimate.Low, estimate.High = estimate.TilesPlaced, estimate.TilesPlaced
+			}
+		}
+
+		row := []string{strconv.Itoa(job.JobID), strconv.Itoa(job.PuzzleID), strconv.Itoa(estimate.Probes),
+			formatFloat(estimate.TilesPlaced), formatFloat(estimate.Low), formatFloat(estimate.High),
+			strconv.FormatBool(exact), "", "", "", ""}
+		if rate > 0 {
+			row[7] = formatFloat(rate)
+			row[8] = formatFloat(estimate.TilesPlaced / rate)
+			row[9] = formatFloat(estimate.Low / rate)
+			row[10] = formatFloat(estimate.High / rate)
+		}
+		writer.Write(row)
+		writer.Flush()
+	}
+	if err := writer.Error(); err != nil {
+		log.Fatal("Couldn't write estimates: ", err)
+	}
+}
+
+// formatFloat writes an estimate with 3 significant digits
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', 3, 64)
+}
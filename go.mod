@@ -1,3 +1,5 @@
 module localhost/flobrm/tilingsolver
 
 go 1.13
+
+require github.com/go-sql-driver/mysql v1.5.0
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// jobQueue is a PuzzleReader that hands out jobs created while solving before reading new ones from input.
+// Queued jobs are also appended to a jobs csv, so they can be solved again if the process stops early.
+type jobQueue struct {
+	mutex     sync.Mutex
+	input     tileio.PuzzleReader
+	jobs      []tileio.PuzzleDescription
+	nextJobID int
+	jobsFile  string
+	writer    *tileio.JobCSVWriter
+	// tiles placed in queued jobs before they were checkpointed, so the status can report the total
+	previousTilesPlaced map[jobKey]uint
+	// hashes of the solutions of checkpointed jobs that are already in the solutions files
+	savedSolutions map[jobKey]map[string]bool
+}
+
+// newJobQueue returns a queue that reads from input once no created jobs are left.
+// Created jobs get consecutive job ids starting at firstJobID, and are saved in jobsFile.
+func newJobQueue(input tileio.PuzzleReader, jobsFile string, firstJobID int) *jobQueue {
+	return &jobQueue{input: input, nextJobID: firstJobID, jobsFile: jobsFile, previousTilesPlaced: make(map[jobKey]uint),
+		savedSolutions: make(map[jobKey]map[string]bool)}
+}
+
+// NextPuzzle returns the oldest queued job, or the next puzzle from input if the queue is empty
+func (q *jobQueue) NextPuzzle() (tileio.PuzzleDescription, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.jobs) > 0 {
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		return job, nil
+	}
+	return q.input.NextPuzzle()
+}
+
+// push assigns job ids to jobs of puzzle puzzleID, saves them in the jobs file and queues them
+func (q *jobQueue) push(puzzleID int, jobs []core.Puzzle) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, job := range jobs {
+		if err := q.save(tileio.NewPuzzleDescription(q.nextJobID, puzzleID, job)); err != nil {
+			return err
+		}
+		q.nextJobID++
+	}
+	return nil
+}
+
+// save appends job to the jobs file and the queue, q.mutex must be held
+func (q *jobQueue) save(job tileio.PuzzleDescription) error {
+	if q.writer == nil {
+		writer, err := tileio.AppendJobCSVWriter(q.jobsFile)
+		if err != nil {
+			return err
+		}
+		q.writer = writer
+	}
+	if err := q.writer.SaveJob(&job); err != nil {
+		return err
+	}
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+// requeueCheckpoints queues the rest of the jobs in the checkpoint files matching pattern, keeping their job ids.
+// The jobs are saved in the jobs file before the checkpoint files are removed, so they can't get lost.
+// The solutions of these jobs in the files matching solutionsPattern are remembered, see savedSolutionsOf.
+func (q *jobQueue) requeueCheckpoints(pattern string, solutionsPattern string) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for _, path := range paths {
+		checkpoint, err := tileio.ReadCheckpoint(path)
+		if err != nil {
+			return err
+		}
+		if err := q.save(checkpoint.Job()); err != nil {
+			return err
+		}
+		key := jobKey{jobID: checkpoint.JobID, puzzleID: checkpoint.PuzzleID}
+		q.previousTilesPlaced[key] += checkpoint.TilesPlaced
+		if q.savedSolutions[key] == nil {
+			q.savedSolutions[key] = make(map[string]bool)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		log.Println("continuing job", checkpoint.JobID, "from checkpoint", path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return q.readSavedSolutions(solutionsPattern)
+}
+
+// readSavedSolutions adds the hashes of the solutions in the files matching pattern to the jobs in q.savedSolutions.
+// Rows that can't be read, like a row that was cut off when the process died, are skipped. q.mutex must be held.
+func (q *jobQueue) readSavedSolutions(pattern string) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		reader, err := tileio.NewSolutionCSVReader(path)
+		if err != nil {
+			return err
+		}
+		for {
+			solution, err := reader.NextSolution()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				continue
+			}
+			if saved, ok := q.savedSolutions[jobKey{jobID: solution.JobID, puzzleID: solution.PuzzleID}]; ok {
+				saved[tileio.SolutionHash(solution.Tiles)] = true
+			}
+		}
+		reader.Close()
+	}
+	return nil
+}
+
+// savedSolutionsOf returns the hashes of the solutions of job that were written before it was checkpointed, nil if
+// it wasn't continued from a checkpoint. The search can find solutions that come after the state of its checkpoint
+// before the checkpoint is written, the parallel solver reports the state of its slowest worker.
+func (q *jobQueue) savedSolutionsOf(job *tileio.PuzzleDescription) map[string]bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.savedSolutions[jobKey{jobID: job.JobID, puzzleID: job.PuzzleID}]
+}
+
+// tilesPlacedBefore returns how many tiles were placed in job before it was checkpointed and queued again
+func (q *jobQueue) tilesPlacedBefore(job *tileio.PuzzleDescription) uint {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.previousTilesPlaced[jobKey{jobID: job.JobID, puzzleID: job.PuzzleID}]
+}
+
+// resplit splits the part of job that comes after currentState into at most numJobs new jobs and queues them.
+// It returns whether the remaining work was handed over to the queue.
+func (q *jobQueue) resplit(ctx context.Context, job *tileio.PuzzleDescription, currentState []core.TilePlacement,
+	opts tiling.Options, numJobs int) bool {
+	remaining := job.Puzzle()
+	remaining.Start = currentState
+	jobs, err := tiling.SplitPuzzle(ctx, remaining, opts, numJobs)
+	if err != nil {
+		log.Println("Couldn't split the remainder of job", job.JobID, err)
+		return false
+	}
+	if err := q.push(job.PuzzleID, jobs); err != nil {
+		log.Println("Couldn't queue the remainder of job", job.JobID, err)
+		return false
+	}
+	log.Println("split the remainder of job", job.JobID, "into", len(jobs), "jobs")
+	return true
+}
+
+// Close closes the jobs file
+func (q *jobQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.writer != nil {
+		q.writer.Close()
+	}
+}
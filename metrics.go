@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsInterval is how often a running job updates the nodes per second of its worker
+const metricsInterval = 5 * time.Second
+
+// processMetrics keeps the numbers the metrics endpoint shows for solveConcurrentTasks and its workers.
+// All methods can be called on a nil *processMetrics, then they do nothing.
+type processMetrics struct {
+	mutex            sync.Mutex
+	workers          int
+	activeWorkers    int
+	puzzlesStarted   uint
+	puzzlesFinished  map[string]uint // by status
+	solutions        uint
+	processEndTime   time.Time
+	workerJobs       []workerMetrics
+	tilesPlacedTotal uint // tiles placed in finished jobs
+}
+
+// workerMetrics describes the job a worker is running
+type workerMetrics struct {
+	busy            bool
+	jobID, puzzleID int
+	tilesPlaced     uint // tiles placed in the current job up to the last progress report
+	nodesPerSecond  float64
+	lastReport      time.Time
+}
+
+func newProcessMetrics(workers int, processEndTime time.Time) *processMetrics {
+	return &processMetrics{
+		workers:         workers,
+		puzzlesFinished: map[string]uint{"solved": 0, "solved1": 0, "interrupted": 0, "split": 0, "infeasible": 0},
+		processEndTime:  processEndTime,
+		workerJobs:      make([]workerMetrics, workers),
+	}
+}
+
+// serveMetrics starts an HTTP server on address that serves the metrics on /metrics, in the Prometheus text format
+func serveMetrics(address string, m *processMetrics) (io.Closer, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.write(w)
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Println("Metrics server stopped: ", err)
+		}
+	}()
+	log.Println("Serving metrics on", listener.Addr())
+	return server, nil
+}
+
+// startJob records that worker started puzzle
+func (m *processMetrics) startJob(worker int, jobID int, puzzleID int) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.activeWorkers++
+	m.puzzlesStarted++
+	m.workerJobs[worker] = workerMetrics{busy: true, jobID: jobID, puzzleID: puzzleID, lastReport: time.Now()}
+}
+
+// finishJob records that worker ended its job with status after placing tilesPlaced tiles
+func (m *processMetrics) finishJob(worker int, status string, tilesPlaced uint) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.activeWorkers--
+	m.puzzlesFinished[status]++
+	m.tilesPlacedTotal += tilesPlaced
+	m.workerJobs[worker] = workerMetrics{}
+}
+
+// addSolutions counts newly found solutions
+func (m *processMetrics) addSolutions(solutions uint) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.solutions += solutions
+}
+
+// reportProgress updates the nodes per second of worker from the tiles placed in its current job
+func (m *processMetrics) reportProgress(worker int, tilesPlaced uint) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job := &m.workerJobs[worker]
+	now := time.Now()
+	if elapsed := now.Sub(job.lastReport).Seconds(); elapsed > 0 && tilesPlaced >= job.tilesPlaced {
+		job.nodesPerSecond = float64(tilesPlaced-job.tilesPlaced) / elapsed
+	}
+	job.tilesPlaced = tilesPlaced
+	job.lastReport = now
+}
+
+// progress returns a Progress that reports to the metrics of worker every metricsInterval, and still reports to
+// inner as often as inner asks for
+func (m *processMetrics) progress(worker int, inner tiling.Progress) tiling.Progress {
+	if m == nil {
+		return inner
+	}
+	return combineProgress(inner, tiling.Progress{
+		Interval: metricsInterval,
+		Report: func(currentState []core.TilePlacement, tilesPlaced uint) {
+			m.reportProgress(worker, tilesPlaced)
+		},
+	})
+}
+
+// write prints all metrics in the Prometheus text format
+func (m *processMetrics) write(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("tilingsolver_workers", "gauge", "Number of workers of the process.")
+	fmt.Fprintf(w, "tilingsolver_workers %d\n", m.workers)
+	metric("tilingsolver_active_workers", "gauge", "Number of workers that are solving a job.")
+	fmt.Fprintf(w, "tilingsolver_active_workers %d\n", m.activeWorkers)
+	metric("tilingsolver_puzzles_started_total", "counter", "Puzzles and jobs started.")
+	fmt.Fprintf(w, "tilingsolver_puzzles_started_total %d\n", m.puzzlesStarted)
+	metric("tilingsolver_puzzles_finished_total", "counter", "Puzzles and jobs that ended, by status.")
+	statuses := make([]string, 0, len(m.puzzlesFinished))
+	for status := range m.puzzlesFinished {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "tilingsolver_puzzles_finished_total{status=%q} %d\n", status, m.puzzlesFinished[status])
+	}
+	metric("tilingsolver_solutions_total", "counter", "Distinct solutions found.")
+	fmt.Fprintf(w, "tilingsolver_solutions_total %d\n", m.solutions)
+	metric("tilingsolver_tiles_placed_total", "counter", "Tiles placed in finished jobs and up to the last progress report of running jobs.")
+	tilesPlaced := m.tilesPlacedTotal
+	for _, job := range m.workerJobs {
+		tilesPlaced += job.tilesPlaced
+	}
+	fmt.Fprintf(w, "tilingsolver_tiles_placed_total %d\n", tilesPlaced)
+	metric("tilingsolver_process_end_time_seconds", "gauge", "Unix time at which the process interrupts its jobs.")
+	fmt.Fprintf(w, "tilingsolver_process_end_time_seconds %d\n", m.processEndTime.Unix())
+
+	metric("tilingsolver_worker_busy", "gauge", "1 if the worker is solving a job, 0 if it is idle.")
+	for worker, job := range m.workerJobs {
+		busy := 0
+		if job.busy {
+			busy = 1
+		}
+		fmt.Fprintf(w, "tilingsolver_worker_busy{worker=\"%d\"} %d\n", worker, busy)
+	}
+	metric("tilingsolver_worker_job_id", "gauge", "job_id of the job the worker is solving.")
+	for worker, job := range m.workerJobs {
+		if job.busy {
+			fmt.Fprintf(w, "tilingsolver_worker_job_id{worker=\"%d\"} %d\n", worker, job.jobID)
+		}
+	}
+	metric("tilingsolver_worker_puzzle_id", "gauge", "puzzle_id of the job the worker is solving.")
+	for worker, job := range m.workerJobs {
+		if job.busy {
+			fmt.Fprintf(w, "tilingsolver_worker_puzzle_id{worker=\"%d\"} %d\n", worker, job.puzzleID)
+		}
+	}
+	metric("tilingsolver_worker_nodes_per_second", "gauge", "Tiles placed per second by the worker between its last two progress reports.")
+	for worker, job := range m.workerJobs {
+		if job.busy {
+			fmt.Fprintf(w, "tilingsolver_worker_nodes_per_second{worker=\"%d\"} %g\n", worker, job.nodesPerSecond)
+		}
+	}
+}
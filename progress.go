@@ -0,0 +1,49 @@
+package main
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tiling"
+	"time"
+)
+
+// combineProgress returns a Progress that calls the Report function of each of progresses about as often as that
+// progress asks for, so a job can report to several places at their own pace
+func combineProgress(progresses ...tiling.Progress) tiling.Progress {
+	var active []tiling.Progress
+	for _, progress := range progresses {
+		if progress.Report != nil {
+			active = append(active, progress)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return tiling.Progress{}
+	case 1:
+		return active[0]
+	}
+
+	combined := tiling.Progress{}
+	nextNodes := make([]uint, len(active))
+	nextTime := make([]time.Time, len(active))
+	for i, progress := range active {
+		if progress.Nodes > 0 && (combined.Nodes == 0 || progress.Nodes < combined.Nodes) {
+			combined.Nodes = progress.Nodes
+		}
+		if progress.Interval > 0 && (combined.Interval == 0 || progress.Interval < combined.Interval) {
+			combined.Interval = progress.Interval
+		}
+		nextNodes[i] = progress.Nodes
+		nextTime[i] = time.Now().Add(progress.Interval)
+	}
+	combined.Report = func(currentState []core.TilePlacement, tilesPlaced uint) {
+		now := time.Now()
+		for i, progress := range active {
+			if progress.Nodes > 0 && tilesPlaced >= nextNodes[i] || progress.Interval > 0 && !now.Before(nextTime[i]) {
+				progress.Report(currentState, tilesPlaced)
+				nextNodes[i] = tilesPlaced + progress.Nodes
+				nextTime[i] = now.Add(progress.Interval)
+			}
+		}
+	}
+	return combined
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// jobKey identifies a job in both the input and the status files
+type jobKey struct {
+	jobID    int
+	puzzleID int
+}
+
+// runResume implements the resume subcommand. It reads the status files of earlier runs and writes the jobs that
+// still have work left, starting where the furthest run stopped. Jobs keep their ids, so resume can be repeated.
+func runResume(args []string) {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	inputFiles := fs.String("input_file", "", "Comma separated files with the puzzles/jobs that were solved")
+	statusFiles := fs.String("status_files", "", "Comma separated status files or glob patterns, like output/*.status.csv")
+	outputFile := fs.String("output_file", "", "File the remaining jobs are written to")
+	skipUnstarted := fs.Bool("skip_unstarted", false, "Leave out jobs without a status row, instead of writing them unchanged")
+	opts := tiling.DefaultOptions()
+	opts.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *inputFiles == "" || *statusFiles == "" || *outputFile == "" {
+		log.Fatal("resume needs an -input_file, -status_files and an -output_file")
+	}
+
+	statuses := make(map[jobKey][]tileio.StatusRecord)
+	paths, err := expandGlobs(*statusFiles)
+	if err != nil {
+		log.Fatal("Invalid status files: ", err)
+	}
+	for _, path := range paths {
+		records, err := tileio.ReadStatusFile(path)
+		if err != nil {
+			log.Fatal("Couldn't read status file: ", err)
+		}
+		for _, record := range records {
+			key := jobKey{jobID: record.JobID, puzzleID: record.PuzzleID}
+			statuses[key] = append(statuses[key], record)
+		}
+	}
+
+	writer, err := tileio.NewJobCSVWriter(*outputFile)
+	if err != nil {
+		log.Fatal("Could not open output file: ", err)
+	}
+	defer writer.Close()
+
+	var finished, resumed, unstarted int
+	for _, inputFile := range strings.Split(*inputFiles, ",") {
+		reader, err := tileio.NewPuzzleCSVReader(inputFile, tileio.ReaderOptions{})
+		if err != nil {
+			log.Fatal("Could not open input file: ", err)
+		}
+		for job, err := reader.NextPuzzle(); err != io.EOF; job, err = reader.NextPuzzle() {
+			if err != nil {
+				log.Fatal(err)
+			}
+			records := statuses[jobKey{jobID: job.JobID, puzzleID: job.PuzzleID}]
+			if len(records) == 0 {
+				unstarted++
+				if *skipUnstarted {
+					continue
+				}
+			} else {
+				puzzle := job.Puzzle()
+				start, done := resumePoint(puzzle, opts, records)
+				if done {
+					finished++
+					continue
+				}
+				resumed++
+				puzzle.Start = start
+				job = tileio.NewPuzzleDescription(job.JobID, job.PuzzleID, puzzle)
+			}
+			if err := writer.SaveJob(&job); err != nil {
+				log.Fatal("Couldn't write job: ", err)
+			}
+		}
+	}
+	log.Println("resume:", resumed, "interrupted jobs resumed,", finished, "finished jobs skipped,", unstarted, "jobs without status")
+}
+
+// expandGlobs returns the files matching a comma separated list of glob patterns, every pattern has to match a file
+func expandGlobs(patterns string) ([]string, error) {
+	var paths []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// resumePoint returns the furthest current_state of the interrupted runs of puzzle, or done if a run finished it.
+// Jobs that were split at runtime count as finished, the jobs they were split into have their own status.
+func resumePoint(puzzle core.Puzzle, opts tiling.Options, records []tileio.StatusRecord) (start []core.TilePlacement, done bool) {
+	start = puzzle.Start
+	for _, record := range records {
+		switch record.Status {
+		case "solved", "solved1", "split", "infeasible":
+			return nil, true
+		case "interrupted":
+			if len(record.CurrentState) > 0 && tiling.ComparePlacements(puzzle, opts, record.CurrentState, start) > 0 {
+				start = record.CurrentState
+			}
+		}
+	}
+	return start, false
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// cancelOnSignal calls cancel on the first SIGINT or SIGTERM, so the workers stop and save the state of their jobs.
+// A second signal exits immediately, without waiting for them. The returned function stops listening for signals.
+func cancelOnSignal(cancel context.CancelFunc) func() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Println("Received", sig, "- interrupting all jobs, send it again to exit without saving them")
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Println("Received", sig, "again, exiting")
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+)
+
+// runSplit implements the split subcommand. It reads puzzles or jobs and writes a jobs csv in which the jobs of
+// each puzzle together cover its search tree exactly once. The solver options must match the ones used to solve.
+func runSplit(args []string) {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	inputFile := fs.String("input_file", "", "File with puzzles/jobs to split")
+	outputFile := fs.String("output_file", "", "File the jobs are written to")
+	depth := fs.Int("depth", 0, "Split at placements of this many tiles, one job per placement unless -jobs is set")
+	numJobs := fs.Int("jobs", 0, "Number of jobs per puzzle, if -depth isn't set the smallest depth with enough placements is used")
+	firstJobID := fs.Int("first_job_id", 1, "job_id of the first job, the next jobs count up from here")
+	opts := tiling.DefaultOptions()
+	opts.RegisterFlags(fs)
+	fs.Parse(args)
+
+	if *inputFile == "" || *outputFile == "" {
+		log.Fatal("split needs an -input_file and an -output_file")
+	}
+	if *depth <= 0 && *numJobs <= 0 {
+		log.Fatal("split needs a -depth or a number of -jobs")
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatal("Invalid solver options: ", err)
+	}
+
+	reader, err := tileio.NewPuzzleCSVReader(*inputFile, tileio.ReaderOptions{})
+	if err != nil {
+		log.Fatal("Could not open input file: ", err)
+	}
+	writer, err := tileio.NewJobCSVWriter(*outputFile)
+	if err != nil {
+		log.Fatal("Could not open output file: ", err)
+	}
+	defer writer.Close()
+
+	jobID := *firstJobID
+	for puzzle, err := reader.NextPuzzle(); err != io.EOF; puzzle, err = reader.NextPuzzle() {
+		if err != nil {
+			log.Fatal(err)
+		}
+		var jobs []core.Puzzle
+		if *depth > 0 {
+			jobs, err = tiling.SplitAtDepth(context.Background(), puzzle.Puzzle(), opts, *depth, *numJobs)
+		} else {
+			jobs, err = tiling.SplitPuzzle(context.Background(), puzzle.Puzzle(), opts, *numJobs)
+		}
+		if err != nil {
+			log.Fatal("Couldn't split job ", puzzle.JobID, ": ", err)
+		}
+		for _, job := range jobs {
+			description := tileio.NewPuzzleDescription(jobID, puzzle.PuzzleID, job)
+			if err := writer.SaveJob(&description); err != nil {
+				log.Fatal("Couldn't write job: ", err)
+			}
+			jobID++
+		}
+		log.Println("split job", puzzle.JobID, "of puzzle", puzzle.PuzzleID, "into", len(jobs), "jobs")
+	}
+}
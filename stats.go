@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"os"
+)
+
+// runStats implements the stats subcommand. It prints the search statistics in the stats column of status files,
+// written by runs with -search_stats, as a table per row or as one table with the sum of all rows.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	statusFiles := fs.String("status_files", "", "Comma separated status files or glob patterns, like output/*.status.csv")
+	sum := fs.Bool("sum", false, "Print one table with the sum of all rows instead of a table per row")
+	fs.Parse(args)
+
+	if *statusFiles == "" {
+		log.Fatal("stats needs -status_files")
+	}
+	paths, err := expandGlobs(*statusFiles)
+	if err != nil {
+		log.Fatal("Invalid status files: ", err)
+	}
+
+	var total tiling.SearchStats
+	rows := 0
+	for _, path := range paths {
+		records, err := tileio.ReadStatusFile(path)
+		if err != nil {
+			log.Fatal("Couldn't read status file: ", err)
+		}
+		for _, record := range records {
+			if record.Stats == "" {
+				continue
+			}
+			var stats tiling.SearchStats
+			if err := json.Unmarshal([]byte(record.Stats), &stats); err != nil {
+				log.Fatalf("%s job %d puzzle %d: invalid stats: %v", path, record.JobID, record.PuzzleID, err)
+			}
+			rows++
+			if *sum {
+				total.Add(&stats)
+				continue
+			}
+			fmt.Printf("%s job %d puzzle %d, %s\n", path, record.JobID, record.PuzzleID, record.Status)
+			stats.WriteTable(os.Stdout)
+			fmt.Println()
+		}
+	}
+	if *sum {
+		fmt.Printf("sum of %d rows\n", rows)
+		total.WriteTable(os.Stdout)
+	}
+	if rows == 0 {
+		log.Println("stats: no rows with stats, solve with -search_stats to collect them")
+	}
+}
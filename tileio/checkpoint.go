@@ -0,0 +1,90 @@
+package tileio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"localhost/flobrm/tilingsolver/core"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the state of a job that is still being solved, saved regularly so the job can continue after a crash
+type Checkpoint struct {
+	JobID        int                  `json:"job_id"`
+	PuzzleID     int                  `json:"puzzle_id"`
+	Board        core.Coord           `json:"board"`
+	Tiles        []core.Coord         `json:"tiles"`
+	Rotations    []core.Rotation      `json:"rotations,omitempty"`
+	Start        []core.TilePlacement `json:"start"`
+	End          []core.TilePlacement `json:"end"`
+	CurrentState []core.TilePlacement `json:"current_state"` // the placements to continue from
+	TilesPlaced  uint                 `json:"tiles_placed"`  // tiles placed in this job up to CurrentState
+	Time         time.Time            `json:"time"`
+}
+
+// NewCheckpoint describes job at currentState, after placing tilesPlaced tiles
+func NewCheckpoint(job *PuzzleDescription, currentState []core.TilePlacement, tilesPlaced uint) Checkpoint {
+	puzzle := job.Puzzle()
+	return Checkpoint{
+		JobID:        job.JobID,
+		PuzzleID:     job.PuzzleID,
+		Board:        puzzle.Board,
+		Tiles:        puzzle.Tiles,
+		Rotations:    puzzle.Rotations,
+		Start:        puzzle.Start,
+		End:          puzzle.End,
+		CurrentState: currentState,
+		TilesPlaced:  tilesPlaced,
+		Time:         time.Now(),
+	}
+}
+
+// Job returns the rest of the job, from CurrentState up to End
+func (c *Checkpoint) Job() PuzzleDescription {
+	start := c.Start
+	if len(c.CurrentState) > 0 {
+		start = c.CurrentState
+	}
+	return NewPuzzleDescription(c.JobID, c.PuzzleID, core.Puzzle{Board: c.Board, Tiles: c.Tiles,
+		Rotations: c.Rotations, Start: start, End: c.End})
+}
+
+// SaveCheckpoint replaces the checkpoint in path. It writes a temporary file first,
+// so path always holds a complete checkpoint even if the process dies while saving.
+func SaveCheckpoint(path string, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ReadCheckpoint reads a checkpoint saved by SaveCheckpoint
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	checkpoint := Checkpoint{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return checkpoint, err
+	}
+	err = json.Unmarshal(data, &checkpoint)
+	return checkpoint, err
+}
@@ -0,0 +1,291 @@
+package tileio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//LeaseRequest asks the coordinator for up to Jobs jobs in the name of Owner
+type LeaseRequest struct {
+	Owner string `json:"owner"`
+	Jobs  int    `json:"jobs"`
+}
+
+//LeaseResponse holds the leased jobs. If there are none, Done tells whether all jobs are finished, or whether
+//the leases of other solvers can still expire and bring jobs back.
+type LeaseResponse struct {
+	Leases []Lease `json:"leases"`
+	Done   bool    `json:"done"`
+}
+
+//Lease gives a solver the right to solve Job until the lease expires, the answers to heartbeats have no Job.
+//Job.CurrentState is where an earlier lease of the job stopped, Job.TilesPlaced the tiles placed before that.
+type Lease struct {
+	LeaseID      string      `json:"lease_id"`
+	LeaseSeconds float64     `json:"lease_seconds"`
+	Job          *Checkpoint `json:"job,omitempty"`
+}
+
+//Heartbeat renews a lease. CurrentState and TilesPlaced are the last progress of the job in this lease, Solutions
+//are the solutions found before CurrentState that weren't sent yet.
+type Heartbeat struct {
+	LeaseID      string               `json:"lease_id"`
+	CurrentState []core.TilePlacement `json:"current_state,omitempty"`
+	TilesPlaced  uint                 `json:"tiles_placed"`
+	Solutions    []string             `json:"solutions,omitempty"`
+}
+
+//StatusReport ends a lease with the status of its job and the solutions that weren't sent yet
+type StatusReport struct {
+	LeaseID   string    `json:"lease_id"`
+	Status    JobStatus `json:"status"`
+	Solutions []string  `json:"solutions,omitempty"`
+}
+
+//JobCoordinator hands out the jobs of a PuzzleReader to solvers over HTTP, and writes what they report to a
+//PuzzleResolutionWriter. A solver leases jobs on /lease and keeps each lease alive on /heartbeat with the current
+//state of the job, until it reports the status on /status. A lease that isn't renewed in time expires, and the job
+//is queued again from the last state its solver reported. Interrupted jobs are queued again the same way.
+//A solution is written once per job, even if a solver that continues the job finds it again.
+//The queue, the leases and the solutions of unfinished jobs are only kept in memory, a coordinator that is restarted
+//starts over at the start of its input and the leases it handed out before are unknown.
+type JobCoordinator struct {
+	mutex     sync.Mutex
+	input     PuzzleReader
+	inputDone bool
+	results   PuzzleResolutionWriter
+	leaseTime time.Duration
+	pending   []Checkpoint //jobs that were given back, handed out before new input
+	leases    map[string]*jobLease
+	saved     map[leaseKey]map[string]bool //hashes of the solutions written for jobs that aren't finished
+}
+
+//jobLease is a job that is being solved
+type jobLease struct {
+	job         Checkpoint
+	owner       string
+	expires     time.Time
+	state       []core.TilePlacement //last reported state, nil if there was no report yet
+	tilesPlaced uint                 //tiles placed in this lease up to state
+}
+
+//NewJobCoordinator returns a coordinator for the jobs in input, leases last leaseTime unless they are renewed
+func NewJobCoordinator(input PuzzleReader, results PuzzleResolutionWriter, leaseTime time.Duration) *JobCoordinator {
+	return &JobCoordinator{input: input, results: results, leaseTime: leaseTime, leases: make(map[string]*jobLease),
+		saved: make(map[leaseKey]map[string]bool)}
+}
+
+//ServeHTTP handles the POST requests /lease, /heartbeat and /status. Heartbeats and reports for leases that
+//expired get status 410 Gone, their job is already queued again.
+func (c *JobCoordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var response interface{}
+	var err error
+	switch r.URL.Path {
+	case "/lease":
+		request := LeaseRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response = c.lease(&request)
+	case "/heartbeat":
+		request := Heartbeat{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err = c.heartbeat(&request)
+	case "/status":
+		request := StatusReport{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		response, err = c.report(&request)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err == errLeaseExpired {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+//errLeaseExpired is returned for requests about a lease the coordinator doesn't know (anymore)
+var errLeaseExpired = errors.New("unknown or expired lease")
+
+//lease hands out up to request.Jobs jobs, given back jobs first
+func (c *JobCoordinator) lease(request *LeaseRequest) *LeaseResponse {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if request.Jobs < 1 {
+		request.Jobs = 1
+	}
+	response := &LeaseResponse{Leases: []Lease{}}
+	for len(response.Leases) < request.Jobs {
+		job, ok := c.nextJob()
+		if !ok {
+			break
+		}
+		id := newLeaseID()
+		c.leases[id] = &jobLease{job: job, owner: request.Owner, expires: time.Now().Add(c.leaseTime)}
+		response.Leases = append(response.Leases, Lease{LeaseID: id, LeaseSeconds: c.leaseTime.Seconds(), Job: &job})
+		log.Println("Leased job", job.JobID, "of puzzle", job.PuzzleID, "to", request.Owner)
+	}
+	response.Done = len(response.Leases) == 0 && len(c.leases) == 0
+	return response
+}
+
+//nextJob returns the oldest given back job, or the next job of the input. c.mutex must be held.
+func (c *JobCoordinator) nextJob() (Checkpoint, bool) {
+	if len(c.pending) > 0 {
+		job := c.pending[0]
+		c.pending = c.pending[1:]
+		return job, true
+	}
+	if c.inputDone {
+		return Checkpoint{}, false
+	}
+	puzzle, err := c.input.NextPuzzle()
+	if err != nil {
+		if err != io.EOF {
+			log.Println("Couldn't read job, no more jobs are handed out:", err)
+		}
+		c.inputDone = true
+		return Checkpoint{}, false
+	}
+	return NewCheckpoint(&puzzle, nil, 0), true
+}
+
+//heartbeat renews a lease, saves the solutions and remembers the state they were found before
+func (c *JobCoordinator) heartbeat(request *Heartbeat) (*Lease, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lease, ok := c.leases[request.LeaseID]
+	if !ok {
+		return nil, errLeaseExpired
+	}
+	if err := c.saveSolutions(&lease.job, request.Solutions); err != nil {
+		return nil, err
+	}
+	if len(request.CurrentState) > 0 {
+		lease.state = request.CurrentState
+		lease.tilesPlaced = request.TilesPlaced
+	}
+	lease.expires = time.Now().Add(c.leaseTime)
+	return &Lease{LeaseID: request.LeaseID, LeaseSeconds: c.leaseTime.Seconds()}, nil
+}
+
+//report ends a lease, it writes the solutions and the status with the tiles placed in earlier leases added.
+//An interrupted job is queued again from its current state.
+func (c *JobCoordinator) report(request *StatusReport) (*Lease, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lease, ok := c.leases[request.LeaseID]
+	if !ok {
+		return nil, errLeaseExpired
+	}
+	if err := c.saveSolutions(&lease.job, request.Solutions); err != nil {
+		return nil, err
+	}
+	status := request.Status
+	status.TilesPlaced += lease.job.TilesPlaced
+	puzzle := lease.job.Job()
+	if err := c.results.SaveStatus(&puzzle, &status); err != nil {
+		return nil, err
+	}
+	delete(c.leases, request.LeaseID)
+	if status.Status == "interrupted" {
+		lease.state, lease.tilesPlaced = status.CurrentState, request.Status.TilesPlaced
+		c.requeue(lease)
+	} else {
+		delete(c.saved, leaseKey{puzzle.JobID, puzzle.PuzzleID})
+	}
+	log.Println("Job", puzzle.JobID, "of puzzle", puzzle.PuzzleID, "ended with status", status.Status, "on", lease.owner)
+	return &Lease{LeaseID: request.LeaseID}, nil
+}
+
+//saveSolutions writes the solutions of job that weren't written yet. A solver can send solutions that come after
+//the state it reported, the parallel solver reports the state of its slowest worker, so the solver that continues
+//the job from that state finds them again. c.mutex must be held.
+func (c *JobCoordinator) saveSolutions(job *Checkpoint, solutions []string) error {
+	key := leaseKey{job.JobID, job.PuzzleID}
+	saved := c.saved[key]
+	for _, solution := range solutions {
+		hash := SolutionHash(solution)
+		if saved[hash] {
+			continue
+		}
+		if err := c.results.SaveSolution(job.PuzzleID, job.JobID, solution); err != nil {
+			return err
+		}
+		if saved == nil {
+			saved = make(map[string]bool)
+			c.saved[key] = saved
+		}
+		saved[hash] = true
+	}
+	return nil
+}
+
+//requeue queues the job of lease again, from the last state its solver reported. c.mutex must be held.
+func (c *JobCoordinator) requeue(lease *jobLease) {
+	job := lease.job
+	if len(lease.state) > 0 {
+		job.CurrentState = lease.state
+	}
+	job.TilesPlaced += lease.tilesPlaced
+	job.Time = time.Now()
+	c.pending = append(c.pending, job)
+}
+
+//ExpireLeases queues the jobs of leases that expired before now again, and returns how many there were
+func (c *JobCoordinator) ExpireLeases(now time.Time) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expired := 0
+	for id, lease := range c.leases {
+		if lease.expires.Before(now) {
+			delete(c.leases, id)
+			c.requeue(lease)
+			expired++
+			log.Println("Lease of job", lease.job.JobID, "of puzzle", lease.job.PuzzleID, "by", lease.owner,
+				"expired, it is queued again")
+		}
+	}
+	return expired
+}
+
+//Done returns whether every job was handed out and reported
+func (c *JobCoordinator) Done() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.inputDone && len(c.pending) == 0 && len(c.leases) == 0
+}
+
+//newLeaseID returns a random hex string
+func newLeaseID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Fatal("Couldn't create lease id: ", err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,107 @@
+package tileio
+
+import (
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//sliceReader returns its puzzles in order
+type sliceReader struct {
+	puzzles []PuzzleDescription
+}
+
+func (r *sliceReader) NextPuzzle() (PuzzleDescription, error) {
+	if len(r.puzzles) == 0 {
+		return PuzzleDescription{}, io.EOF
+	}
+	puzzle := r.puzzles[0]
+	r.puzzles = r.puzzles[1:]
+	return puzzle, nil
+}
+
+//recordingWriter keeps everything written to it
+type recordingWriter struct {
+	mutex     sync.Mutex
+	solutions []string
+	statuses  []JobStatus
+}
+
+func (w *recordingWriter) Close() {}
+
+func (w *recordingWriter) SaveSolutions(puzzleID int, jobID int, solutions *map[string]int) error {
+	for solution := range *solutions {
+		w.SaveSolution(puzzleID, jobID, solution)
+	}
+	return nil
+}
+
+func (w *recordingWriter) SaveSolution(puzzleID int, jobID int, solution string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.solutions = append(w.solutions, solution)
+	return nil
+}
+
+func (w *recordingWriter) SaveStatus(puzzle *PuzzleDescription, status *JobStatus) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.statuses = append(w.statuses, *status)
+	return nil
+}
+
+func testJob(jobID int) PuzzleDescription {
+	tiles := []core.Coord{{X: 1, Y: 1}, {X: 1, Y: 1}}
+	return PuzzleDescription{JobID: jobID, PuzzleID: 1, Board: core.Coord{X: 2, Y: 1}, Tiles: &tiles}
+}
+
+func TestCoordinatorSavesSolutionsOnce(t *testing.T) {
+	results := &recordingWriter{}
+	coordinator := NewJobCoordinator(&sliceReader{[]PuzzleDescription{testJob(1), testJob(2)}}, results, time.Minute)
+	state := []core.TilePlacement{{Idx: 0, Rot: false}}
+
+	//the first solver sends a solution that comes after the state it reports, and stops
+	first := coordinator.lease(&LeaseRequest{Owner: "first", Jobs: 1})
+	_, err := coordinator.heartbeat(&Heartbeat{LeaseID: first.Leases[0].LeaseID, CurrentState: state,
+		Solutions: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired := coordinator.ExpireLeases(time.Now().Add(time.Hour)); expired != 1 {
+		t.Fatalf("%d leases expired, expected 1", expired)
+	}
+
+	//the second solver continues from the state and finds the solution again
+	second := coordinator.lease(&LeaseRequest{Owner: "second", Jobs: 1})
+	if job := second.Leases[0].Job; job.JobID != 1 || !reflect.DeepEqual(job.CurrentState, state) {
+		t.Fatalf("leased job %d from %v, expected job 1 from %v", job.JobID, job.CurrentState, state)
+	}
+	_, err = coordinator.report(&StatusReport{LeaseID: second.Leases[0].LeaseID, Status: JobStatus{Status: "solved"},
+		Solutions: []string{"b", "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(results.solutions, expected) {
+		t.Errorf("saved solutions %v, expected %v", results.solutions, expected)
+	}
+
+	//solutions of other jobs are saved even if they are the same
+	third := coordinator.lease(&LeaseRequest{Owner: "third", Jobs: 1})
+	_, err = coordinator.report(&StatusReport{LeaseID: third.Leases[0].LeaseID, Status: JobStatus{Status: "solved"},
+		Solutions: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a", "b", "c", "a"}; !reflect.DeepEqual(results.solutions, expected) {
+		t.Errorf("saved solutions %v, expected %v", results.solutions, expected)
+	}
+	if len(coordinator.saved) != 0 {
+		t.Errorf("solutions of finished jobs are kept: %v", coordinator.saved)
+	}
+	if response := coordinator.lease(&LeaseRequest{Owner: "third", Jobs: 1}); !response.Done || !coordinator.Done() {
+		t.Error("coordinator isn't done after all jobs are finished")
+	}
+}
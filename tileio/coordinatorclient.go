@@ -0,0 +1,289 @@
+package tileio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"localhost/flobrm/tilingsolver/core"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//CoordinatorClient implements PuzzleReader and PuzzleResolutionWriter on a JobCoordinator. It leases batchSize jobs
+//at a time, and keeps all its leases alive with heartbeats that carry the last state SaveProgress got. Solutions are
+//sent with the first heartbeat after the state they were found before, or with the status. The state of the parallel
+//solver is that of its slowest worker, so some of them can come after the state, the coordinator drops them when the
+//solver that continues the job sends them again.
+type CoordinatorClient struct {
+	url          string
+	owner        string
+	batchSize    int
+	pollInterval time.Duration //wait between lease requests while other solvers still have jobs
+	http         *http.Client
+
+	mutex       sync.Mutex
+	batch       []*clientLease //leased jobs that NextPuzzle didn't return yet
+	leases      map[leaseKey]*clientLease
+	heartbeat   time.Duration
+	interrupted chan struct{}
+	stop        chan struct{}
+	stopped     sync.WaitGroup
+
+	interruptOnce, closeOnce sync.Once
+}
+
+type leaseKey struct {
+	jobID, puzzleID int
+}
+
+//clientLease is a leased job, the mutex fields are guarded by CoordinatorClient.mutex
+type clientLease struct {
+	id          string
+	job         PuzzleDescription
+	sending     sync.Mutex //held while results of the lease are sent, so they are sent in order
+	state       []core.TilePlacement
+	tilesPlaced uint
+	solutions   []string //solutions that weren't sent yet
+	beforeState int      //solutions[:beforeState] were found before state was reported
+	lost        bool
+}
+
+//NewCoordinatorClient returns a client of the coordinator at url, that leases jobs in the name of owner
+func NewCoordinatorClient(url string, owner string, batchSize int) *CoordinatorClient {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	c := &CoordinatorClient{
+		url:          strings.TrimSuffix(url, "/"),
+		owner:        owner,
+		batchSize:    batchSize,
+		pollInterval: 10 * time.Second,
+		http:         &http.Client{Timeout: time.Minute},
+		leases:       make(map[leaseKey]*clientLease),
+		heartbeat:    time.Second, //until the first lease tells how long leases last
+		interrupted:  make(chan struct{}),
+		stop:         make(chan struct{}),
+	}
+	c.stopped.Add(1)
+	go c.sendHeartbeats()
+	return c
+}
+
+//NextPuzzle returns the next leased job, it leases a new batch when the last one is used up. While other solvers
+//still have jobs that could come back it waits. It returns io.EOF when all jobs are finished or after Interrupt.
+func (c *CoordinatorClient) NextPuzzle() (PuzzleDescription, error) {
+	for {
+		c.mutex.Lock()
+		if len(c.batch) > 0 {
+			lease := c.batch[0]
+			c.batch = c.batch[1:]
+			c.mutex.Unlock()
+			return lease.job, nil
+		}
+		c.mutex.Unlock()
+
+		select {
+		case <-c.interrupted:
+			return PuzzleDescription{}, io.EOF
+		default:
+		}
+		response := LeaseResponse{}
+		if err := c.post("/lease", &LeaseRequest{Owner: c.owner, Jobs: c.batchSize}, &response); err != nil {
+			return PuzzleDescription{}, err
+		}
+		if len(response.Leases) == 0 {
+			if response.Done {
+				return PuzzleDescription{}, io.EOF
+			}
+			select {
+			case <-c.interrupted:
+				return PuzzleDescription{}, io.EOF
+			case <-time.After(c.pollInterval):
+			}
+			continue
+		}
+		c.mutex.Lock()
+		for _, lease := range response.Leases {
+			if lease.Job == nil {
+				continue
+			}
+			l := &clientLease{id: lease.LeaseID, job: lease.Job.Job()}
+			c.leases[leaseKey{l.job.JobID, l.job.PuzzleID}] = l
+			c.batch = append(c.batch, l)
+			if heartbeat := time.Duration(lease.LeaseSeconds * float64(time.Second) / 3); heartbeat > 0 {
+				c.heartbeat = heartbeat
+			}
+		}
+		c.mutex.Unlock()
+	}
+}
+
+//Interrupt makes NextPuzzle return io.EOF instead of waiting for jobs
+func (c *CoordinatorClient) Interrupt() {
+	c.interruptOnce.Do(func() { close(c.interrupted) })
+}
+
+//Close stops the heartbeats, jobs that were leased but not finished are handed out again when their lease expires
+func (c *CoordinatorClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		c.stopped.Wait()
+	})
+}
+
+//SaveSolutions keeps the solutions until they can be sent
+func (c *CoordinatorClient) SaveSolutions(puzzleID int, jobID int, solutions *map[string]int) error {
+	for solution := range *solutions {
+		if err := c.SaveSolution(puzzleID, jobID, solution); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//SaveSolution keeps the solution until it can be sent
+func (c *CoordinatorClient) SaveSolution(puzzleID int, jobID int, solution string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lease, ok := c.leases[leaseKey{jobID, puzzleID}]
+	if !ok {
+		return fmt.Errorf("job %d of puzzle %d isn't leased", jobID, puzzleID)
+	}
+	lease.solutions = append(lease.solutions, solution)
+	return nil
+}
+
+//ProgressInterval is how often the coordinator wants to know the state of running jobs
+func (c *CoordinatorClient) ProgressInterval() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.heartbeat
+}
+
+//SaveProgress remembers the state of a job for the next heartbeat
+func (c *CoordinatorClient) SaveProgress(puzzle *PuzzleDescription, currentState []core.TilePlacement,
+	tilesPlaced uint) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lease, ok := c.leases[leaseKey{puzzle.JobID, puzzle.PuzzleID}]
+	if !ok {
+		return fmt.Errorf("job %d of puzzle %d isn't leased", puzzle.JobID, puzzle.PuzzleID)
+	}
+	lease.state = append(lease.state[:0], currentState...)
+	lease.tilesPlaced = tilesPlaced
+	lease.beforeState = len(lease.solutions)
+	return nil
+}
+
+//SaveStatus sends the status and the remaining solutions of a job, which ends its lease. If the lease expired the
+//job is handed out again, that isn't an error of the solver.
+func (c *CoordinatorClient) SaveStatus(puzzle *PuzzleDescription, status *JobStatus) error {
+	key := leaseKey{puzzle.JobID, puzzle.PuzzleID}
+	c.mutex.Lock()
+	lease, ok := c.leases[key]
+	c.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("job %d of puzzle %d isn't leased", puzzle.JobID, puzzle.PuzzleID)
+	}
+	lease.sending.Lock()
+	defer lease.sending.Unlock()
+	c.mutex.Lock()
+	if c.leases[key] == lease {
+		delete(c.leases, key)
+	}
+	report := StatusReport{LeaseID: lease.id, Status: *status, Solutions: lease.solutions}
+	c.mutex.Unlock()
+	err := c.post("/status", &report, &Lease{})
+	if err == errLeaseExpired {
+		log.Println("Lease of job", puzzle.JobID, "of puzzle", puzzle.PuzzleID,
+			"expired before its status was sent, the coordinator will hand it out again")
+		return nil
+	}
+	return err
+}
+
+//sendHeartbeats renews all leases until Close
+func (c *CoordinatorClient) sendHeartbeats() {
+	defer c.stopped.Done()
+	for {
+		c.mutex.Lock()
+		interval := c.heartbeat
+		c.mutex.Unlock()
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		c.mutex.Lock()
+		leases := make([]*clientLease, 0, len(c.leases))
+		for _, lease := range c.leases {
+			if !lease.lost {
+				leases = append(leases, lease)
+			}
+		}
+		c.mutex.Unlock()
+		for _, lease := range leases {
+			c.sendHeartbeat(lease)
+		}
+	}
+}
+
+//sendHeartbeat renews lease with its last state and the solutions found before that state
+func (c *CoordinatorClient) sendHeartbeat(lease *clientLease) {
+	lease.sending.Lock()
+	defer lease.sending.Unlock()
+	c.mutex.Lock()
+	if c.leases[leaseKey{lease.job.JobID, lease.job.PuzzleID}] != lease {
+		c.mutex.Unlock()
+		return //the status was sent in the meantime
+	}
+	heartbeat := Heartbeat{
+		LeaseID:      lease.id,
+		CurrentState: append([]core.TilePlacement(nil), lease.state...),
+		TilesPlaced:  lease.tilesPlaced,
+		Solutions:    lease.solutions[:lease.beforeState:lease.beforeState],
+	}
+	c.mutex.Unlock()
+
+	err := c.post("/heartbeat", &heartbeat, &Lease{})
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err == errLeaseExpired {
+		lease.lost = true
+		log.Println("Lease of job", lease.job.JobID, "of puzzle", lease.job.PuzzleID,
+			"expired, the coordinator will hand it out again")
+	} else if err != nil {
+		log.Println("Couldn't renew lease of job", lease.job.JobID, "of puzzle", lease.job.PuzzleID, ":", err)
+	} else {
+		lease.solutions = lease.solutions[len(heartbeat.Solutions):]
+		lease.beforeState -= len(heartbeat.Solutions)
+	}
+}
+
+//post sends request as JSON to path on the coordinator and decodes the answer into response.
+//It returns errLeaseExpired if the coordinator doesn't know the lease.
+func (c *CoordinatorClient) post(path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Post(c.url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return errLeaseExpired
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("coordinator answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,351 @@
+package tileio
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"log"
+	"time"
+)
+
+//States of a row in the jobs table, finished jobs get the status they ended with
+const (
+	JobPending  = "pending"  //waiting for a solver
+	JobReserved = "reserved" //handed out to the solver in reserved_by
+	JobInvalid  = "invalid"  //couldn't be read, see the log of the solver that reserved it
+)
+
+//PuzzleTablesSQL creates the tables PuzzleDBReader and PuzzleDBWriter use, in MySQL syntax.
+//jobs has the columns of the input csv, with start and end as start_state and end_state. New rows need state
+//'pending'. statuses and solutions have the columns of the status and solutions csv files.
+var PuzzleTablesSQL = []string{
+	`CREATE TABLE IF NOT EXISTS jobs (
+	job_id INT NOT NULL,
+	puzzle_id INT NOT NULL,
+	num_tiles INT NOT NULL,
+	board_width INT NOT NULL,
+	board_height INT NOT NULL,
+	tiles TEXT NOT NULL,
+	start_state TEXT NOT NULL,
+	end_state TEXT NOT NULL,
+	state VARCHAR(16) NOT NULL DEFAULT 'pending',
+	reserved_by VARCHAR(64) NOT NULL DEFAULT '',
+	reserved_at BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (job_id, puzzle_id),
+	INDEX jobs_state (state, job_id, puzzle_id))`,
+	`CREATE TABLE IF NOT EXISTS statuses (
+	job_id INT NOT NULL,
+	puzzle_id INT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	tiles_placed BIGINT UNSIGNED NOT NULL,
+	duration BIGINT NOT NULL,
+	solver_id INT NOT NULL,
+	current_state TEXT NOT NULL,
+	solver VARCHAR(32) NOT NULL,
+	options TEXT NOT NULL,
+	solutions INT NOT NULL,
+	corner_counts TEXT NOT NULL,
+	stats TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	finished_at BIGINT NOT NULL,
+	INDEX statuses_job (job_id, puzzle_id))`,
+	`CREATE TABLE IF NOT EXISTS solutions (
+	puzzle_id INT NOT NULL,
+	job_id INT NOT NULL,
+	tiles TEXT NOT NULL,
+	tiles_hash CHAR(40) NOT NULL,
+	INDEX solutions_job (puzzle_id, job_id),
+	INDEX solutions_hash (puzzle_id, tiles_hash))`,
+}
+
+//puzzleColumnsAdded are the columns of PuzzleTablesSQL that tables created by an older version don't have yet
+var puzzleColumnsAdded = []struct {
+	table, column, definition string
+}{
+	{"statuses", "reason", "TEXT NOT NULL AFTER stats"},
+}
+
+//CreatePuzzleTables runs PuzzleTablesSQL on db, and adds the columns of puzzleColumnsAdded to existing tables that
+//miss them
+func CreatePuzzleTables(db *sql.DB) error {
+	for _, statement := range PuzzleTablesSQL {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	for _, added := range puzzleColumnsAdded {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`, added.table, added.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		log.Println("Adding column", added.column, "to table", added.table)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", added.table, added.column,
+			added.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//PuzzleDBReader implements PuzzleReader on the jobs table of a database. It reserves pending jobs in batches, the rows
+//are locked while they are reserved, so any number of solver processes can share one table without getting the same
+//job twice. Close sets the reserved jobs that weren't returned by NextPuzzle back to 'pending'. A reservation that
+//wasn't renewed for longer than the expiry, because its solver died, is taken over like a pending job. A PuzzleDBWriter
+//with the same owner renews the reservations while jobs are running.
+//Row locks that skip locked rows need MySQL 8 or MariaDB 10.6.
+type PuzzleDBReader struct {
+	db        *sql.DB
+	batchSize int
+	owner     string
+	expiry    time.Duration
+	batch     []PuzzleDescription
+}
+
+//NewPuzzleDBReader returns a reader that reserves batchSize jobs at a time in the name of owner. Reservations of other
+//owners expire after expiry, they never do if expiry is 0.
+func NewPuzzleDBReader(db *sql.DB, batchSize int, owner string, expiry time.Duration) *PuzzleDBReader {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &PuzzleDBReader{db: db, batchSize: batchSize, owner: owner, expiry: expiry}
+}
+
+//NextPuzzle returns the next reserved job, it reserves a new batch when the last one is used up.
+//It returns io.EOF when there are no pending jobs left.
+func (r *PuzzleDBReader) NextPuzzle() (PuzzleDescription, error) {
+	if len(r.batch) == 0 {
+		if err := r.reserve(); err != nil {
+			return PuzzleDescription{}, err
+		}
+		if len(r.batch) == 0 {
+			return PuzzleDescription{}, io.EOF
+		}
+	}
+	puzzle := r.batch[0]
+	r.batch = r.batch[1:]
+	return puzzle, nil
+}
+
+//Close sets the jobs that are still reserved by this reader but weren't returned by NextPuzzle back to 'pending', so
+//other solvers can get them. The reader can't be used afterwards.
+func (r *PuzzleDBReader) Close() error {
+	if len(r.batch) == 0 {
+		return nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, puzzle := range r.batch {
+		_, err := tx.Exec(`UPDATE jobs SET state = ?, reserved_by = '', reserved_at = 0
+			WHERE job_id = ? AND puzzle_id = ? AND state = ? AND reserved_by = ?`,
+			JobPending, puzzle.JobID, puzzle.PuzzleID, JobReserved, r.owner)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	r.batch = nil
+	return nil
+}
+
+//reserve fills r.batch with up to batchSize pending jobs or jobs with an expired reservation, and marks them as
+//reserved in one transaction. Jobs that can't be read are marked invalid and skipped.
+func (r *PuzzleDBReader) reserve() error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	expired := int64(0) //reserved_at is never negative
+	if r.expiry > 0 {
+		expired = now - int64(r.expiry/time.Second)
+	}
+	rows, err := tx.Query(`SELECT job_id, puzzle_id, num_tiles, board_width, board_height, tiles, start_state, end_state,
+		state, reserved_by FROM jobs WHERE state = ? OR state = ? AND reserved_at < ?
+		ORDER BY job_id, puzzle_id LIMIT ? FOR UPDATE SKIP LOCKED`, JobPending, JobReserved, expired, r.batchSize)
+	if err != nil {
+		return err
+	}
+	type reservation struct {
+		jobID, puzzleID int
+		state           string
+	}
+	var reserved []reservation
+	for rows.Next() {
+		var jobID, puzzleID, numTiles, width, height int
+		var tiles, start, end, state, reservedBy string
+		err := rows.Scan(&jobID, &puzzleID, &numTiles, &width, &height, &tiles, &start, &end, &state, &reservedBy)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if state == JobReserved {
+			log.Println("Taking over job", jobID, "of puzzle", puzzleID, "from", reservedBy, "whose reservation expired")
+		}
+		puzzle, err := parseDBJob(jobID, puzzleID, numTiles, width, height, tiles, start, end)
+		if err != nil {
+			log.Println("Invalid job", jobID, "of puzzle", puzzleID, "in the database:", err)
+			reserved = append(reserved, reservation{jobID, puzzleID, JobInvalid})
+			continue
+		}
+		reserved = append(reserved, reservation{jobID, puzzleID, JobReserved})
+		r.batch = append(r.batch, puzzle)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		r.batch = nil
+		return err
+	}
+
+	for _, job := range reserved {
+		_, err := tx.Exec(`UPDATE jobs SET state = ?, reserved_by = ?, reserved_at = ? WHERE job_id = ? AND puzzle_id = ?`,
+			job.state, r.owner, now, job.jobID, job.puzzleID)
+		if err != nil {
+			r.batch = nil
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		r.batch = nil
+		return err
+	}
+	return nil
+}
+
+//parseDBJob converts the columns of a row of the jobs table to a PuzzleDescription
+func parseDBJob(jobID, puzzleID, numTiles, width, height int, tilesJSON, startJSON, endJSON string) (PuzzleDescription, error) {
+	tiles, rotations, err := parseTiles(tilesJSON, numTiles)
+	if err != nil {
+		return PuzzleDescription{}, fmt.Errorf("invalid tiles: %v", err)
+	}
+	var start, end []core.TilePlacement
+	if startJSON != "" {
+		if err := json.Unmarshal([]byte(startJSON), &start); err != nil {
+			return PuzzleDescription{}, fmt.Errorf("invalid start_state: %v", err)
+		}
+	}
+	if endJSON != "" {
+		if err := json.Unmarshal([]byte(endJSON), &end); err != nil {
+			return PuzzleDescription{}, fmt.Errorf("invalid end_state: %v", err)
+		}
+	}
+	return PuzzleDescription{
+		JobID:     jobID,
+		PuzzleID:  puzzleID,
+		Board:     core.Coord{X: width, Y: height},
+		Tiles:     &tiles,
+		Rotations: &rotations,
+		Start:     &start,
+		End:       &end}, nil
+}
+
+//PuzzleDBWriter implements PuzzleResolutionWriter on the statuses and solutions tables of a database, and sets the
+//state of finished jobs in the jobs table to their status. Interrupted jobs are set back to 'pending' from where they
+//stopped. As a ProgressWriter it renews the reservations of its owner while jobs are running.
+//It is safe for concurrent use by several workers.
+type PuzzleDBWriter struct {
+	db     *sql.DB
+	owner  string
+	expiry time.Duration
+}
+
+//NewPuzzleDBWriter returns a writer to db for the jobs reserved by owner, that renews their reservations often enough
+//not to expire after expiry. The caller keeps db open while the writer is used.
+func NewPuzzleDBWriter(db *sql.DB, owner string, expiry time.Duration) *PuzzleDBWriter {
+	return &PuzzleDBWriter{db: db, owner: owner, expiry: expiry}
+}
+
+//Close does nothing, the database is closed by its owner
+func (w *PuzzleDBWriter) Close() {}
+
+//SaveSolutions inserts all solutions of a job in one transaction
+func (w *PuzzleDBWriter) SaveSolutions(puzzleID int, jobID int, solutions *map[string]int) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for tiles := range *solutions {
+		if err := insertSolution(tx, puzzleID, jobID, tiles); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//SaveSolution inserts a single solution
+func (w *PuzzleDBWriter) SaveSolution(puzzleID int, jobID int, solution string) error {
+	return insertSolution(w.db, puzzleID, jobID, solution)
+}
+
+//execer is the part of sql.DB and sql.Tx insertSolution needs
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertSolution(db execer, puzzleID int, jobID int, tiles string) error {
+	_, err := db.Exec(`INSERT INTO solutions (puzzle_id, job_id, tiles, tiles_hash) VALUES (?, ?, ?, ?)`,
+		puzzleID, jobID, tiles, SolutionHash(tiles))
+	return err
+}
+
+//ProgressInterval renews the reservations three times per expiry, 0 if they don't expire
+func (w *PuzzleDBWriter) ProgressInterval() time.Duration {
+	return w.expiry / 3
+}
+
+//SaveProgress renews the reservations of all jobs of the owner, including the ones that aren't started yet
+func (w *PuzzleDBWriter) SaveProgress(puzzle *PuzzleDescription, currentState []core.TilePlacement,
+	tilesPlaced uint) error {
+	_, err := w.db.Exec(`UPDATE jobs SET reserved_at = ? WHERE state = ? AND reserved_by = ?`,
+		time.Now().Unix(), JobReserved, w.owner)
+	return err
+}
+
+//SaveStatus inserts the status of a job and sets its state in the jobs table to the status, in one transaction.
+//An interrupted job is set back to 'pending', with its current_state as start_state. The jobs table isn't changed if
+//the reservation expired and the job was taken over by another owner.
+func (w *PuzzleDBWriter) SaveStatus(puzzle *PuzzleDescription, status *JobStatus) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO statuses (job_id, puzzle_id, status, tiles_placed, duration, solver_id, current_state,
+		solver, options, solutions, corner_counts, stats, reason, finished_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		puzzle.JobID, puzzle.PuzzleID, status.Status, uint64(status.TilesPlaced),
+		status.Duration.Nanoseconds(), status.SolverID, placementsToJSON(status.CurrentState), status.Solver,
+		status.Options, status.Solutions, countsToJSON(status.CornerCounts), status.Stats, status.Reason, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if status.Status == "interrupted" {
+		start := status.CurrentState
+		if len(start) == 0 && puzzle.Start != nil {
+			start = *puzzle.Start
+		}
+		_, err = tx.Exec(`UPDATE jobs SET state = ?, start_state = ?, reserved_by = '', reserved_at = 0
+			WHERE job_id = ? AND puzzle_id = ? AND reserved_by = ?`,
+			JobPending, placementsToJSON(start), puzzle.JobID, puzzle.PuzzleID, w.owner)
+	} else {
+		_, err = tx.Exec(`UPDATE jobs SET state = ? WHERE job_id = ? AND puzzle_id = ? AND reserved_by = ?`,
+			status.Status, puzzle.JobID, puzzle.PuzzleID, w.owner)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,251 @@
+package tileio
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeDB is a database/sql driver that records the statements and queries it executes, and answers queries with the
+//rows of the first entry of results whose key the query starts with
+type fakeDB struct {
+	mu         sync.Mutex
+	results    map[string][][]driver.Value
+	statements []fakeStatement
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+//updates returns the statements starting with prefix, with the whitespace of the query collapsed
+func (db *fakeDB) updates(prefix string) []fakeStatement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var found []fakeStatement
+	for _, statement := range db.statements {
+		query := strings.Join(strings.Fields(statement.query), " ")
+		if strings.HasPrefix(query, prefix) {
+			found = append(found, fakeStatement{query, statement.args})
+		}
+	}
+	return found
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.statements = append(s.db.statements, fakeStatement{s.query, args})
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.statements = append(s.db.statements, fakeStatement{s.query, args})
+	query := strings.Join(strings.Fields(s.query), " ")
+	for prefix, rows := range s.db.results {
+		if strings.HasPrefix(query, prefix) {
+			delete(s.db.results, prefix) //the next query gets no rows
+			return &fakeRows{rows: rows}, nil
+		}
+	}
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return &fakeRows{rows: [][]driver.Value{{int64(0)}}}, nil
+	}
+	if strings.HasPrefix(query, "SELECT") {
+		return &fakeRows{}, nil
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+//fakeJob is a row of the jobs table as reserve selects it
+func fakeJob(jobID int64) []driver.Value {
+	return []driver.Value{jobID, int64(1), int64(2), int64(2), int64(1), `[{"X":1,"Y":1},{"X":1,"Y":1}]`, "", "",
+		JobPending, ""}
+}
+
+func TestPuzzleDBReaderReleasesUnusedJobs(t *testing.T) {
+	fake := &fakeDB{results: map[string][][]driver.Value{
+		"SELECT job_id": {fakeJob(1), fakeJob(2), fakeJob(3)},
+	}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	reader := NewPuzzleDBReader(db, 3, "test", time.Minute)
+	puzzle, err := reader.NextPuzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puzzle.JobID != 1 {
+		t.Fatalf("got job %d, expected job 1", puzzle.JobID)
+	}
+	if reserved := fake.updates("UPDATE jobs SET state = ?, reserved_by = ?"); len(reserved) != 3 {
+		t.Fatalf("%d jobs reserved, expected 3", len(reserved))
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var released []int64
+	for _, update := range fake.updates("UPDATE jobs SET state = ?, reserved_by = ''") {
+		if update.args[0] != JobPending || update.args[3] != JobReserved || update.args[4] != "test" {
+			t.Errorf("unexpected release %s %v", update.query, update.args)
+		}
+		released = append(released, update.args[1].(int64))
+	}
+	if expected := []int64{2, 3}; !reflect.DeepEqual(released, expected) {
+		t.Errorf("released jobs %v, expected %v", released, expected)
+	}
+
+	//there's nothing left to release
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if released := fake.updates("UPDATE jobs SET state = ?, reserved_by = ''"); len(released) != 2 {
+		t.Errorf("%d releases after closing twice, expected 2", len(released))
+	}
+}
+
+func TestPuzzleDBReaderTakesOverExpiredReservations(t *testing.T) {
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	if _, err := NewPuzzleDBReader(db, 1, "test", time.Minute).NextPuzzle(); err != io.EOF {
+		t.Fatalf("got %v from an empty table, expected io.EOF", err)
+	}
+	selects := fake.updates("SELECT job_id")
+	if len(selects) != 1 {
+		t.Fatalf("%d selects, expected 1", len(selects))
+	}
+	args := selects[0].args
+	expired := time.Now().Add(-time.Minute).Unix()
+	if args[0] != JobPending || args[1] != JobReserved || args[2].(int64) < expired-1 || args[2].(int64) > expired {
+		t.Errorf("selected jobs with %v, expected pending jobs and jobs reserved before %d", args, expired)
+	}
+
+	//reservations that don't expire are never older than 0
+	NewPuzzleDBReader(db, 1, "test", 0).NextPuzzle()
+	if args := fake.updates("SELECT job_id")[1].args; args[2] != int64(0) {
+		t.Errorf("selected jobs reserved before %v without an expiry", args[2])
+	}
+}
+
+func TestPuzzleDBWriterSetsInterruptedJobsPending(t *testing.T) {
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	writer := NewPuzzleDBWriter(db, "test", time.Minute)
+	if interval := writer.ProgressInterval(); interval != 20*time.Second {
+		t.Errorf("progress interval %v, expected 20s", interval)
+	}
+
+	start := []core.TilePlacement{{Idx: 0, Rot: false}}
+	puzzle := PuzzleDescription{JobID: 1, PuzzleID: 2, Start: &start}
+	state := []core.TilePlacement{{Idx: 1, Rot: true}, {Idx: 0, Rot: false}}
+	if err := writer.SaveProgress(&puzzle, state, 10); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []JobStatus{{Status: "interrupted", CurrentState: state}, {Status: "interrupted"},
+		{Status: "solved"}} {
+		if err := writer.SaveStatus(&puzzle, &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renewed := fake.updates("UPDATE jobs SET reserved_at = ?")
+	if len(renewed) != 1 || renewed[0].args[1] != JobReserved || renewed[0].args[2] != "test" {
+		t.Errorf("renewed reservations with %v, expected the reservations of test", renewed)
+	}
+	expected := [][]driver.Value{
+		{JobPending, `[{"Idx":1,"Rot":true},{"Idx":0,"Rot":false}]`, int64(1), int64(2), "test"},
+		{JobPending, `[{"Idx":0,"Rot":false}]`, int64(1), int64(2), "test"}, //without a state it starts over
+	}
+	var pending [][]driver.Value
+	for _, update := range fake.updates("UPDATE jobs SET state = ?, start_state = ?") {
+		pending = append(pending, update.args)
+	}
+	if !reflect.DeepEqual(pending, expected) {
+		t.Errorf("interrupted jobs updated with %v, expected %v", pending, expected)
+	}
+	finished := fake.updates("UPDATE jobs SET state = ? WHERE")
+	if len(finished) != 1 || !reflect.DeepEqual(finished[0].args, []driver.Value{"solved", int64(1), int64(2), "test"}) {
+		t.Errorf("solved job updated with %v", finished)
+	}
+}
+
+func TestCreatePuzzleTablesAddsMissingColumns(t *testing.T) {
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	if err := CreatePuzzleTables(db); err != nil {
+		t.Fatal(err)
+	}
+	if altered := fake.updates("ALTER TABLE statuses ADD COLUMN reason"); len(altered) != 1 {
+		t.Errorf("reason added %d times to an old statuses table, expected once", len(altered))
+	}
+
+	//tables that have the column are left alone
+	fake = &fakeDB{results: map[string][][]driver.Value{"SELECT COUNT(*)": {{int64(1)}}}}
+	db = sql.OpenDB(fake)
+	defer db.Close()
+	if err := CreatePuzzleTables(db); err != nil {
+		t.Fatal(err)
+	}
+	if altered := fake.updates("ALTER TABLE"); len(altered) != 0 {
+		t.Errorf("existing columns altered: %v", altered)
+	}
+}
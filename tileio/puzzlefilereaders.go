@@ -10,6 +10,9 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 //PuzzleReader is an interface supplying all functions for getting puzzles input
@@ -19,137 +22,227 @@ type PuzzleReader interface {
 
 //A PuzzleCSVReader accepts a csv filename and implements the PuzzleReader interface
 type PuzzleCSVReader struct {
+	path       string
 	reader     *csv.Reader
 	header     map[string]int
 	lineNumber int
+	opts       ReaderOptions
+	err        error //returned by every later call once a line was rejected in strict mode
 }
 
+//ReaderOptions says what PuzzleCSVReader and PuzzleJSONReader do with rows they can't read. By default they are
+//logged and skipped.
+type ReaderOptions struct {
+	Strict  bool          //NextPuzzle returns an error for the first bad row, instead of skipping it
+	Rejects *RejectWriter //if set, skipped rows are written here instead of to the log
+}
+
+//requiredColumns are the columns of the input csv without a default, start and end are empty if they are missing
+var requiredColumns = []string{"job_id", "puzzle_id", "num_tiles", "board_width", "board_height", "tiles"}
+
 //PuzzleDescription describes a tiling puzzle
 type PuzzleDescription struct {
-	JobID    int
-	PuzzleID int
-	Board    core.Coord
-	Tiles    *[]core.Coord
-	Start    *[]core.TilePlacement
-	End      *[]core.TilePlacement
+	JobID     int
+	PuzzleID  int
+	Board     core.Coord
+	Tiles     *[]core.Coord
+	Rotations *[]core.Rotation //nil or empty if all tiles can rotate freely
+	Start     *[]core.TilePlacement
+	End       *[]core.TilePlacement
 }
 
-//NewPuzzleCSVReader opens a csv file and return an object that will reader puzzles 1 by 1
+//Puzzle returns the puzzle or job in the format the solvers use
+func (p *PuzzleDescription) Puzzle() core.Puzzle {
+	puzzle := core.Puzzle{Board: p.Board}
+	if p.Tiles != nil {
+		puzzle.Tiles = *p.Tiles
+	}
+	if p.Rotations != nil && len(*p.Rotations) > 0 {
+		puzzle.Rotations = *p.Rotations
+	}
+	if p.Start != nil {
+		puzzle.Start = *p.Start
+	}
+	if p.End != nil {
+		puzzle.End = *p.End
+	}
+	return puzzle
+}
+
+//NewPuzzleDescription wraps a puzzle or job from the solvers so it can be written
+func NewPuzzleDescription(jobID int, puzzleID int, puzzle core.Puzzle) PuzzleDescription {
+	return PuzzleDescription{
+		JobID:     jobID,
+		PuzzleID:  puzzleID,
+		Board:     puzzle.Board,
+		Tiles:     &puzzle.Tiles,
+		Rotations: &puzzle.Rotations,
+		Start:     &puzzle.Start,
+		End:       &puzzle.End,
+	}
+}
+
+//NewPuzzleCSVReader opens a csv file and returns a reader that reads puzzles from it 1 by 1.
+//It returns an error if the file can't be opened or the header misses a required column.
 //TODO make it read the whole file at once, so it can close the file again
-func NewPuzzleCSVReader(path string) PuzzleReader {
+func NewPuzzleCSVReader(path string, opts ReaderOptions) (*PuzzleCSVReader, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatal("Couldn't open file ", path, err)
+		return nil, err
 	}
 	csvReader := csv.NewReader(file)
-	if err != nil {
-		log.Fatal("Couldn't make csvReader ", err)
-	}
 	csvReader.TrimLeadingSpace = true
 
 	header := make(map[string]int, 8)
 	headerNames, err := csvReader.Read()
 	if err != nil {
-		log.Fatal("Couldn't read header ", err)
+		file.Close()
+		return nil, fmt.Errorf("couldn't read header of %s: %v", path, err)
 	}
 	for i, name := range headerNames {
 		header[name] = i
 	}
-	puzzleReader := PuzzleCSVReader{reader: csvReader, header: header}
-
-	return puzzleReader
+	for _, name := range requiredColumns {
+		if _, ok := header[name]; !ok {
+			file.Close()
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	return &PuzzleCSVReader{path: path, reader: csvReader, header: header, lineNumber: 1, opts: opts}, nil
 }
 
 //NextPuzzle reads lines until it encounters a correct puzzle and returns a PuzzleDescription,
-//or err if there are no puzzles left in the file
-func (r PuzzleCSVReader) NextPuzzle() (PuzzleDescription, error) {
-	for true {
+//or io.EOF if there are no puzzles left in the file. Bad lines are skipped, or returned as error in strict mode.
+func (r *PuzzleCSVReader) NextPuzzle() (PuzzleDescription, error) {
+	for r.err == nil {
 		record, err := r.reader.Read()
 		r.lineNumber++
+		if err == io.EOF {
+			return PuzzleDescription{}, io.EOF
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
+			if _, ok := err.(*csv.ParseError); !ok {
+				return PuzzleDescription{}, err
+			}
+		} else {
+			var puzzle PuzzleDescription
+			if puzzle, err = r.parseRecord(record); err == nil {
+				return puzzle, nil
 			}
-			fmt.Println("error reading puzzle at line:", r.lineNumber, "error:", err)
-			continue
 		}
-		fmt.Print(record)
+		r.err = reject(r.opts, r.path, r.lineNumber, err, csvLine(record))
+	}
+	return PuzzleDescription{}, r.err
+}
 
-		tiles := make([]core.Coord, parseInt(record[r.header["num_tiles"]]))
-		err = json.Unmarshal([]byte(record[r.header["tiles"]]), &tiles)
+//parseRecord converts a line of the csv file to a PuzzleDescription
+func (r *PuzzleCSVReader) parseRecord(record []string) (PuzzleDescription, error) {
+	field := func(name string) string {
+		if i, ok := r.header[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	ints := make(map[string]int, 5)
+	for _, name := range []string{"job_id", "puzzle_id", "num_tiles", "board_width", "board_height"} {
+		value, err := strconv.Atoi(field(name))
 		if err != nil {
-			fmt.Println("error reading tiles at line:", r.lineNumber, "error:", err)
-			continue
+			return PuzzleDescription{}, fmt.Errorf("invalid %s: %v", name, err)
 		}
+		ints[name] = value
+	}
 
-		var start []core.TilePlacement
-		if len(record[r.header["start"]]) != 0 {
-			err = json.Unmarshal([]byte(record[r.header["start"]]), &start)
-			if err != nil {
-				fmt.Println("error reading start at line:", r.lineNumber, "error:", err)
-				continue
-			}
+	tiles, rotations, err := parseTiles(field("tiles"), ints["num_tiles"])
+	if err != nil {
+		return PuzzleDescription{}, fmt.Errorf("invalid tiles: %v", err)
+	}
+	var start []core.TilePlacement
+	if len(field("start")) != 0 {
+		if err := json.Unmarshal([]byte(field("start")), &start); err != nil {
+			return PuzzleDescription{}, fmt.Errorf("invalid start: %v", err)
 		}
-		var end []core.TilePlacement
-		if len(record[r.header["end"]]) != 0 {
-			err = json.Unmarshal([]byte(record[r.header["end"]]), &end)
-			if err != nil {
-				fmt.Println("error reading end at line:", r.lineNumber, "error:", err)
-				continue
-			}
+	}
+	var end []core.TilePlacement
+	if len(field("end")) != 0 {
+		if err := json.Unmarshal([]byte(field("end")), &end); err != nil {
+			return PuzzleDescription{}, fmt.Errorf("invalid end: %v", err)
 		}
+	}
 
-		puzzle := PuzzleDescription{
-			JobID:    parseInt(record[r.header["job_id"]]),
-			PuzzleID: parseInt(record[r.header["puzzle_id"]]),
-			Board: core.Coord{
-				X: parseInt(record[r.header["board_width"]]),
-				Y: parseInt(record[r.header["board_height"]])},
-			Tiles: &tiles,
-			Start: &start,
-			End:   &end}
-		return puzzle, nil
+	return PuzzleDescription{
+		JobID:     ints["job_id"],
+		PuzzleID:  ints["puzzle_id"],
+		Board:     core.Coord{X: ints["board_width"], Y: ints["board_height"]},
+		Tiles:     &tiles,
+		Rotations: &rotations,
+		Start:     &start,
+		End:       &end}, nil
+}
+
+//tileJSON is a tile in the tiles column, the rotation is left out for tiles that can rotate freely
+type tileJSON struct {
+	X, Y     int
+	Rotation core.Rotation `json:",omitempty"`
+}
+
+//parseTiles reads the tiles column, rotations is nil if all tiles can rotate freely
+func parseTiles(data string, numTiles int) (tiles []core.Coord, rotations []core.Rotation, err error) {
+	tileList := make([]tileJSON, 0, numTiles)
+	if err := json.Unmarshal([]byte(data), &tileList); err != nil {
+		return nil, nil, err
 	}
-	return PuzzleDescription{}, io.EOF
+	tiles = make([]core.Coord, len(tileList))
+	for i, tile := range tileList {
+		tiles[i] = core.Coord{X: tile.X, Y: tile.Y}
+		if tile.Rotation != core.RotationFree {
+			if rotations == nil {
+				rotations = make([]core.Rotation, len(tileList))
+			}
+			rotations[i] = tile.Rotation
+		}
+	}
+	return tiles, rotations, nil
 }
 
-//parseInt converts string to int or dies
-func parseInt(s string) int {
-	myInt, err := strconv.Atoi(s)
-	if err != nil {
-		log.Fatal("tried converting", s, "to int")
+//tilesToJSON writes the tiles column in the format parseTiles reads
+func tilesToJSON(tiles []core.Coord, rotations []core.Rotation) ([]byte, error) {
+	if len(rotations) == 0 {
+		return json.Marshal(tiles)
+	}
+	if len(rotations) != len(tiles) {
+		return nil, fmt.Errorf("%d rotations for %d tiles", len(rotations), len(tiles))
 	}
-	return myInt
+	tileList := make([]tileJSON, len(tiles))
+	for i, tile := range tiles {
+		tileList[i] = tileJSON{X: tile.X, Y: tile.Y, Rotation: rotations[i]}
+	}
+	return json.Marshal(tileList)
 }
 
 //Start of puzzleJSONReader stuff
 
 //PuzzleJSONReader reads files where each line describes a puzzle in JSON. The full file doesn't have to be in JSON
 type PuzzleJSONReader struct {
+	path       string
 	reader     *bufio.Scanner
 	lineNumber int
+	opts       ReaderOptions
+	err        error //returned by every later call once a line was rejected in strict mode
 }
 
-//NewPuzzleJSONReader opens a file and return an object that will read puzzles 1 by 1
-func NewPuzzleJSONReader(path string) PuzzleReader {
+//NewPuzzleJSONReader opens a file and returns a reader that reads puzzles from it 1 by 1
+func NewPuzzleJSONReader(path string, opts ReaderOptions) (*PuzzleJSONReader, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatal("Couldn't open file ", path, err)
+		return nil, err
 	}
-
-	reader := bufio.NewScanner(file)
-	if err != nil {
-		log.Fatal("Couldn't make scanner ", err)
-	}
-
-	puzzleReader := PuzzleJSONReader{reader: reader, lineNumber: 0}
-
-	return puzzleReader
+	return &PuzzleJSONReader{path: path, reader: bufio.NewScanner(file), opts: opts}, nil
 }
 
-//NextPuzzle reads lines until it encounters a valid
-func (r PuzzleJSONReader) NextPuzzle() (PuzzleDescription, error) {
-	for r.reader.Scan() {
+//NextPuzzle reads lines until it encounters a valid puzzle, or returns io.EOF at the end of the file.
+//Bad lines are skipped, or returned as error in strict mode.
+func (r *PuzzleJSONReader) NextPuzzle() (PuzzleDescription, error) {
+	for r.err == nil && r.reader.Scan() {
 		line := r.reader.Bytes()
 		r.lineNumber++
 
@@ -158,7 +251,244 @@ func (r PuzzleJSONReader) NextPuzzle() (PuzzleDescription, error) {
 		if err == nil {
 			return puzzle, nil
 		}
-		fmt.Println("lineNumber:", r.lineNumber, "error:", err)
+		r.err = reject(r.opts, r.path, r.lineNumber, err, string(line))
+	}
+	if r.err != nil {
+		return PuzzleDescription{}, r.err
+	}
+	if err := r.reader.Err(); err != nil {
+		return PuzzleDescription{}, err
 	}
 	return PuzzleDescription{}, io.EOF
 }
+
+//RejectWriter writes the input lines a reader skipped as csv, with the file, line number and reason
+type RejectWriter struct {
+	mutex  sync.Mutex
+	writer *csv.Writer
+}
+
+//NewRejectWriter writes the header of the reject csv to w
+func NewRejectWriter(w io.Writer) *RejectWriter {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"file", "line", "reason", "row"})
+	writer.Flush()
+	return &RejectWriter{writer: writer}
+}
+
+//Reject writes a skipped line, row is the line as it was in the input
+func (w *RejectWriter) Reject(path string, lineNumber int, reason string, row string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.writer.Write([]string{path, strconv.Itoa(lineNumber), reason, row})
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+//reject handles a line that couldn't be read: in strict mode it returns the reason as error, otherwise it writes
+//the line to the reject writer or the log
+func reject(opts ReaderOptions, path string, lineNumber int, reason error, row string) error {
+	if opts.Strict {
+		return fmt.Errorf("%s line %d: %v", path, lineNumber, reason)
+	}
+	if opts.Rejects != nil {
+		return opts.Rejects.Reject(path, lineNumber, reason.Error(), row)
+	}
+	log.Println("Skipping", path, "line", lineNumber, ":", reason)
+	return nil
+}
+
+//csvLine encodes a record as a line of csv, without the line end
+func csvLine(record []string) string {
+	var line strings.Builder
+	writer := csv.NewWriter(&line)
+	writer.Write(record)
+	writer.Flush()
+	return strings.TrimRight(line.String(), "\r\n")
+}
+
+//Start of status file stuff
+
+//StatusRecord is a row of a status file written by PuzzleCSVWriter
+type StatusRecord struct {
+	JobID    int
+	PuzzleID int
+	JobStatus
+}
+
+//ReadStatusFile reads all rows of a status file. Files written by several runs repeat the header, those lines are skipped.
+//Columns missing in older status files are left empty.
+func ReadStatusFile(path string) ([]StatusRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+
+	headerNames, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read header of %s: %v", path, err)
+	}
+	header := make(map[string]int, len(headerNames))
+	for i, name := range headerNames {
+		header[name] = i
+	}
+	for _, name := range []string{"job_id", "puzzle_id", "status"} {
+		if _, ok := header[name]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := header[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	records := make([]StatusRecord, 0)
+	for lineNumber := 2; ; lineNumber++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, lineNumber, err)
+		}
+		if record[0] == headerNames[0] {
+			continue
+		}
+		status := StatusRecord{JobStatus: JobStatus{
+			Status:  field(record, "status"),
+			Solver:  field(record, "solver"),
+			Options: field(record, "options"),
+			Stats:   field(record, "stats"),
+			Reason:  field(record, "reason")}}
+		if status.JobID, err = strconv.Atoi(field(record, "job_id")); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid job_id: %v", path, lineNumber, err)
+		}
+		if status.PuzzleID, err = strconv.Atoi(field(record, "puzzle_id")); err != nil {
+			return nil, fmt.Errorf("%s line %d: invalid puzzle_id: %v", path, lineNumber, err)
+		}
+		if tilesPlaced := field(record, "tiles_placed"); tilesPlaced != "" {
+			placed, err := strconv.ParseUint(tilesPlaced, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid tiles_placed: %v", path, lineNumber, err)
+			}
+			status.TilesPlaced = uint(placed)
+		}
+		if duration := field(record, "duration"); duration != "" {
+			nanoseconds, err := strconv.ParseInt(duration, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid duration: %v", path, lineNumber, err)
+			}
+			status.Duration = time.Duration(nanoseconds)
+		}
+		if solverID := field(record, "solver_id"); solverID != "" {
+			if status.SolverID, err = strconv.Atoi(solverID); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid solver_id: %v", path, lineNumber, err)
+			}
+		}
+		if currentState := field(record, "current_state"); currentState != "" {
+			if err := json.Unmarshal([]byte(currentState), &status.CurrentState); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid current_state: %v", path, lineNumber, err)
+			}
+		}
+		if solutions := field(record, "solutions"); solutions != "" {
+			if status.Solutions, err = strconv.Atoi(solutions); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid solutions: %v", path, lineNumber, err)
+			}
+		}
+		if cornerCounts := field(record, "corner_counts"); cornerCounts != "" {
+			if err := json.Unmarshal([]byte(cornerCounts), &status.CornerCounts); err != nil {
+				return nil, fmt.Errorf("%s line %d: invalid corner_counts: %v", path, lineNumber, err)
+			}
+		}
+		records = append(records, status)
+	}
+	return records, nil
+}
+
+//Start of solutions file stuff
+
+//SolutionRecord is a row of a solutions file written by PuzzleCSVWriter
+type SolutionRecord struct {
+	PuzzleID   int
+	JobID      int
+	Tiles      string //json encoded tiles of the solution
+	TilesHash  string
+	LineNumber int //line of the row in the file
+}
+
+//SolutionCSVReader reads the rows of a solutions file one by one, solution files can be too large to read at once
+type SolutionCSVReader struct {
+	file       *os.File
+	reader     *csv.Reader
+	header     []string
+	columns    map[string]int
+	lineNumber int
+}
+
+//NewSolutionCSVReader opens a solutions file and reads its header
+func NewSolutionCSVReader(path string) (*SolutionCSVReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("couldn't read header of %s: %v", path, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"puzzle_id", "job_id", "tiles", "tiles_hash"} {
+		if _, ok := columns[name]; !ok {
+			file.Close()
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	return &SolutionCSVReader{file: file, reader: csvReader, header: header, columns: columns, lineNumber: 1}, nil
+}
+
+//NextSolution returns the next row, skipping the headers repeated by later runs. It returns io.EOF at the end of
+//the file, other errors describe a row that couldn't be read, reading can continue after them.
+func (r *SolutionCSVReader) NextSolution() (SolutionRecord, error) {
+	for {
+		record, err := r.reader.Read()
+		r.lineNumber++
+		if err == io.EOF {
+			return SolutionRecord{}, io.EOF
+		}
+		if err != nil {
+			return SolutionRecord{LineNumber: r.lineNumber}, fmt.Errorf("line %d: %v", r.lineNumber, err)
+		}
+		if record[0] == r.header[0] {
+			continue
+		}
+		field := func(name string) string {
+			if i := r.columns[name]; i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		solution := SolutionRecord{Tiles: field("tiles"), TilesHash: field("tiles_hash"), LineNumber: r.lineNumber}
+		if solution.PuzzleID, err = strconv.Atoi(field("puzzle_id")); err != nil {
+			return solution, fmt.Errorf("line %d: invalid puzzle_id: %v", r.lineNumber, err)
+		}
+		if solution.JobID, err = strconv.Atoi(field("job_id")); err != nil {
+			return solution, fmt.Errorf("line %d: invalid job_id: %v", r.lineNumber, err)
+		}
+		return solution, nil
+	}
+}
+
+//Close closes the file
+func (r *SolutionCSVReader) Close() error {
+	return r.file.Close()
+}
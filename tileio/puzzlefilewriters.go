@@ -1,14 +1,18 @@
 package tileio
 
 import (
+	"bufio"
 	"crypto/sha1"
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"localhost/flobrm/tilingsolver/core"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,8 +20,30 @@ import (
 type PuzzleResolutionWriter interface {
 	Close()
 	SaveSolutions(puzzleID int, jobID int, solutions *map[string]int) error
-	SaveStatus(puzzle *PuzzleDescription, status string, tilesPlaced uint, solveTime time.Duration,
-		solverID int, placements *[]core.TilePlacement) error
+	SaveSolution(puzzleID int, jobID int, solution string) error
+	SaveStatus(puzzle *PuzzleDescription, status *JobStatus) error
+}
+
+// ProgressWriter is implemented by PuzzleResolutionWriters that also want to know the state of running jobs,
+// about every ProgressInterval.
+type ProgressWriter interface {
+	ProgressInterval() time.Duration
+	SaveProgress(puzzle *PuzzleDescription, currentState []core.TilePlacement, tilesPlaced uint) error
+}
+
+// JobStatus describes how solving a puzzle or job ended
+type JobStatus struct {
+	Status       string               `json:"status"`                  // solved, solved1, interrupted or infeasible
+	TilesPlaced  uint                 `json:"tiles_placed"`            // number of tiles placed (and possibly removed again)
+	Duration     time.Duration        `json:"duration"`                // time spent on this puzzle or job
+	SolverID     int                  `json:"solver_id"`               // identifies the solver and hardware
+	CurrentState []core.TilePlacement `json:"current_state,omitempty"` // the tiles on the board when the solver stopped
+	Solver       string               `json:"solver"`                  // name of the search algorithm
+	Options      string               `json:"options"`                 // the solver options used, as command line flags
+	Solutions    int                  `json:"solutions"`               // number of distinct solutions found
+	CornerCounts []int                `json:"corner_counts,omitempty"` // solutions per tile in the bottom left corner, if they were counted
+	Stats        string               `json:"stats,omitempty"`         // search statistics as JSON, if they were collected
+	Reason       string               `json:"reason,omitempty"`        // why the puzzle is infeasible
 }
 
 // PuzzleCSVWriter keeps track of outputfiles, and implements PuzzleResolutionWriter
@@ -26,25 +52,61 @@ type PuzzleCSVWriter struct {
 	solutionsFile *os.File
 }
 
-// NewPuzzleCSVWriter opens two files for writing and return a PuzzleCSVWriter with them.
+// Headers of the status and solutions files
+const (
+	statusHeader = "job_id,puzzle_id,status,tiles_placed,duration,solver_id,current_state,solver,options," +
+		"solutions,corner_counts,stats,reason\n"
+	solutionsHeader = "puzzle_id,job_id,tiles,tiles_hash\n"
+)
+
+// NewPuzzleCSVWriter opens two files for appending and return a PuzzleCSVWriter with them.
+// The headers are written to empty files, files that start with another header are refused.
 func NewPuzzleCSVWriter(statusFilename string, SolutionsFilename string) (*PuzzleCSVWriter, error) {
-	//TODO add header if statusFile doesn't have one already
-	statusFile, err := os.OpenFile(statusFilename, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.FileMode(0666))
+	statusFile, err := openCSVFile(statusFilename, statusHeader)
 	if err != nil {
 		log.Println("Can't open statusFile ", err.Error())
 		return nil, err
 	}
-	//TODO add header if solutionsfile doesn't have one already
-	solutionsFile, err := os.OpenFile(SolutionsFilename, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.FileMode(0666))
+	solutionsFile, err := openCSVFile(SolutionsFilename, solutionsHeader)
 	if err != nil {
-		log.Println("Can't open statusFile ", err.Error())
+		log.Println("Can't open solutionsFile ", err.Error())
+		statusFile.Close()
 		return nil, err
 	}
-	statusFile.WriteString("job_id,puzzle_id,status,tiles_placed,duration,solver_id,current_state\n")
-	solutionsFile.WriteString("puzzle_id,job_id,tiles,tiles_hash\n")
 	return &PuzzleCSVWriter{statusFile: statusFile, solutionsFile: solutionsFile}, nil
 }
 
+// openCSVFile opens filename for appending and writes header if the file is empty. A file that already has content has
+// to start with header, so all its rows have the same columns.
+func openCSVFile(filename string, header string) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.FileMode(0666))
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		_, err = file.WriteString(header)
+	} else {
+		var firstLine string
+		firstLine, err = bufio.NewReader(file).ReadString('\n') //reads from the start, only writes are appended
+		if err == nil && firstLine != header {
+			err = fmt.Errorf("%s starts with the header %q instead of %q, use a new file", filename,
+				strings.TrimSpace(firstLine), strings.TrimSpace(header))
+		} else if err == io.EOF {
+			err = fmt.Errorf("%s doesn't start with a header line", filename)
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
 //Close closes all filedescriptors
 func (w *PuzzleCSVWriter) Close() {
 	w.statusFile.Close()
@@ -56,12 +118,7 @@ func (w *PuzzleCSVWriter) SaveSolutions(puzzleID int, jobID int, solutions *map[
 
 	writer := csv.NewWriter(w.solutionsFile)
 	for tiles := range *solutions {
-		//write puzzleID, jobID, tiles, hash
-		hasher := sha1.New()
-		hasher.Write([]byte(tiles))
-		hashString := hex.EncodeToString(hasher.Sum(nil))
-
-		err := writer.Write([]string{strconv.Itoa(puzzleID), strconv.Itoa(jobID), tiles, hashString})
+		err := writer.Write(solutionRecord(puzzleID, jobID, tiles))
 		if err != nil {
 			return err
 		}
@@ -71,31 +128,139 @@ func (w *PuzzleCSVWriter) SaveSolutions(puzzleID int, jobID int, solutions *map[
 	return err
 }
 
-//SaveStatus writes the results of a job to a file
-func (w *PuzzleCSVWriter) SaveStatus(puzzle *PuzzleDescription, status string, tilesPlaced uint, solveTime time.Duration,
-	solverID int, placements *[]core.TilePlacement) error {
+//SaveSolution appends a single solution to w.solutionsFile, so solutions can be saved while the solver is running.
+//The file is only synced to disk by SaveStatus, to keep this cheap for puzzles with many solutions.
+func (w *PuzzleCSVWriter) SaveSolution(puzzleID int, jobID int, solution string) error {
+	writer := csv.NewWriter(w.solutionsFile)
+	writer.Write(solutionRecord(puzzleID, jobID, solution))
+	writer.Flush()
+	return writer.Error()
+}
 
-	writer := csv.NewWriter(w.statusFile)
+//solutionRecord builds the csv fields puzzleID, jobID, tiles, hash
+func solutionRecord(puzzleID int, jobID int, tiles string) []string {
+	return []string{strconv.Itoa(puzzleID), strconv.Itoa(jobID), tiles, SolutionHash(tiles)}
+}
 
-	placementString := ""
-	if placements != nil && len(*placements) != 0 {
-		placementBytes, err := json.Marshal(placements)
-		if err != nil {
-			log.Fatal("Error marshalling placement: ", placements, err)
-		}
-		placementString = string(placementBytes)
+//SolutionHash returns the tiles_hash of a solution, the hex encoded sha1 of its tiles field
+func SolutionHash(tiles string) string {
+	hasher := sha1.New()
+	hasher.Write([]byte(tiles))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+//SaveStatus writes the results of a job to a file
+func (w *PuzzleCSVWriter) SaveStatus(puzzle *PuzzleDescription, status *JobStatus) error {
+	// make sure streamed solutions are on disk before the status says the job is done
+	if err := w.solutionsFile.Sync(); err != nil {
+		return err
 	}
 
+	writer := csv.NewWriter(w.statusFile)
+
 	writer.Write([]string{
 		strconv.Itoa(puzzle.JobID),
 		strconv.Itoa(puzzle.PuzzleID),
-		status,
-		strconv.FormatUint(uint64(tilesPlaced), 10),
-		strconv.FormatInt(solveTime.Nanoseconds(), 10),
-		strconv.Itoa(solverID),
-		placementString})
+		status.Status,
+		strconv.FormatUint(uint64(status.TilesPlaced), 10),
+		strconv.FormatInt(status.Duration.Nanoseconds(), 10),
+		strconv.Itoa(status.SolverID),
+		placementsToJSON(status.CurrentState),
+		status.Solver,
+		status.Options,
+		strconv.Itoa(status.Solutions),
+		countsToJSON(status.CornerCounts),
+		status.Stats,
+		status.Reason})
 
 	writer.Flush()
 	err := w.statusFile.Sync()
 	return err
 }
+
+// JobCSVWriter writes puzzles and jobs in the csv format PuzzleCSVReader reads
+type JobCSVWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+// NewJobCSVWriter creates or truncates path and writes the csv header to it
+func NewJobCSVWriter(path string) (*JobCSVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return newJobCSVWriter(file, true), nil
+}
+
+// AppendJobCSVWriter opens path to add jobs at the end, the header is only written if the file is new or empty
+func AppendJobCSVWriter(path string) (*JobCSVWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, os.FileMode(0666))
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return newJobCSVWriter(file, info.Size() == 0), nil
+}
+
+func newJobCSVWriter(file *os.File, writeHeader bool) *JobCSVWriter {
+	writer := csv.NewWriter(file)
+	if writeHeader {
+		writer.Write([]string{"job_id", "puzzle_id", "num_tiles", "board_width", "board_height", "tiles", "start", "end"})
+	}
+	return &JobCSVWriter{file: file, writer: writer}
+}
+
+// SaveJob appends a job to the file
+func (w *JobCSVWriter) SaveJob(job *PuzzleDescription) error {
+	puzzle := job.Puzzle()
+	tiles, err := tilesToJSON(puzzle.Tiles, puzzle.Rotations)
+	if err != nil {
+		return err
+	}
+	w.writer.Write([]string{
+		strconv.Itoa(job.JobID),
+		strconv.Itoa(job.PuzzleID),
+		strconv.Itoa(len(puzzle.Tiles)),
+		strconv.Itoa(puzzle.Board.X),
+		strconv.Itoa(puzzle.Board.Y),
+		string(tiles),
+		placementsToJSON(puzzle.Start),
+		placementsToJSON(puzzle.End)})
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Close flushes and closes the file
+func (w *JobCSVWriter) Close() error {
+	w.writer.Flush()
+	return w.file.Close()
+}
+
+// countsToJSON encodes counts as a json array, or returns an empty string if they weren't counted
+func countsToJSON(counts []int) string {
+	if counts == nil {
+		return ""
+	}
+	countBytes, err := json.Marshal(counts)
+	if err != nil {
+		log.Fatal("Error marshalling counts: ", counts, err)
+	}
+	return string(countBytes)
+}
+
+// placementsToJSON encodes placements as a json array, or returns an empty string if there are none
+func placementsToJSON(placements []core.TilePlacement) string {
+	if len(placements) == 0 {
+		return ""
+	}
+	placementBytes, err := json.Marshal(placements)
+	if err != nil {
+		log.Fatal("Error marshalling placement: ", placements, err)
+	}
+	return string(placementBytes)
+}
@@ -0,0 +1,76 @@
+package tileio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPuzzleCSVWriterWritesTheHeaderOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tileio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statusFile, solutionsFile := filepath.Join(dir, "1_0.status.csv"), filepath.Join(dir, "1_0.solutions.csv")
+
+	for i := 0; i < 2; i++ {
+		writer, err := NewPuzzleCSVWriter(statusFile, solutionsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.SaveSolution(1, 1, "[]"); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+	}
+	for file, header := range map[string]string{statusFile: statusHeader, solutionsFile: solutionsHeader} {
+		if content := readFile(t, file); !strings.HasPrefix(content, header) || strings.Count(content, header) != 1 {
+			t.Errorf("%s doesn't have one header at the start:\n%s", file, content)
+		}
+	}
+	if lines := strings.Count(readFile(t, solutionsFile), "\n"); lines != 3 {
+		t.Errorf("solutions file has %d lines, expected a header and 2 solutions", lines)
+	}
+}
+
+func TestPuzzleCSVWriterRefusesOtherHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tileio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statusFile, solutionsFile := filepath.Join(dir, "1_0.status.csv"), filepath.Join(dir, "1_0.solutions.csv")
+
+	//a status file from before the reason column
+	oldStatus := "job_id,puzzle_id,status,tiles_placed,duration,solver_id,current_state,solver,options,solutions," +
+		"corner_counts,stats\n1,1,solved,10,100,1,,naive,,0,,\n"
+	if err := ioutil.WriteFile(statusFile, []byte(oldStatus), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPuzzleCSVWriter(statusFile, solutionsFile); err == nil {
+		t.Error("appending to a status file with another header")
+	}
+	if content := readFile(t, statusFile); content != oldStatus {
+		t.Errorf("status file with another header changed to:\n%s", content)
+	}
+
+	//a file without a complete line
+	if err := ioutil.WriteFile(statusFile, []byte("job_id,puzzle_id"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPuzzleCSVWriter(statusFile, solutionsFile); err == nil {
+		t.Error("appending to a status file without a header line")
+	}
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
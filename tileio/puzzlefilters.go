@@ -0,0 +1,176 @@
+package tileio
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//PuzzleFilter returns whether a puzzle or job should be read
+type PuzzleFilter func(puzzle *PuzzleDescription) bool
+
+//filterReader returns the puzzles of input that pass all filters
+type filterReader struct {
+	input   PuzzleReader
+	filters []PuzzleFilter
+}
+
+//NewFilterReader returns a PuzzleReader that skips the puzzles of input that don't pass every filter
+func NewFilterReader(input PuzzleReader, filters ...PuzzleFilter) PuzzleReader {
+	if len(filters) == 0 {
+		return input
+	}
+	return &filterReader{input: input, filters: filters}
+}
+
+//NextPuzzle returns the next puzzle of the input that passes all filters
+func (r *filterReader) NextPuzzle() (PuzzleDescription, error) {
+	for {
+		puzzle, err := r.input.NextPuzzle()
+		if err != nil || r.passes(&puzzle) {
+			return puzzle, err
+		}
+	}
+}
+
+func (r *filterReader) passes(puzzle *PuzzleDescription) bool {
+	for _, filter := range r.filters {
+		if !filter(puzzle) {
+			return false
+		}
+	}
+	return true
+}
+
+//skipReader drops the first skip puzzles of input
+type skipReader struct {
+	input PuzzleReader
+	skip  int
+}
+
+//NewSkipReader returns a PuzzleReader that leaves out the first n puzzles of input
+func NewSkipReader(input PuzzleReader, n int) PuzzleReader {
+	if n <= 0 {
+		return input
+	}
+	return &skipReader{input: input, skip: n}
+}
+
+//NextPuzzle reads and drops puzzles until n are skipped, then returns the next one
+func (r *skipReader) NextPuzzle() (PuzzleDescription, error) {
+	for ; r.skip > 0; r.skip-- {
+		if _, err := r.input.NextPuzzle(); err != nil {
+			return PuzzleDescription{}, err
+		}
+	}
+	return r.input.NextPuzzle()
+}
+
+//limitReader stops after limit puzzles
+type limitReader struct {
+	input PuzzleReader
+	left  int
+}
+
+//NewLimitReader returns a PuzzleReader that returns io.EOF after n puzzles of input, puzzles after those aren't read
+func NewLimitReader(input PuzzleReader, n int) PuzzleReader {
+	return &limitReader{input: input, left: n}
+}
+
+//NextPuzzle returns the next puzzle of the input if the limit isn't reached yet
+func (r *limitReader) NextPuzzle() (PuzzleDescription, error) {
+	if r.left <= 0 {
+		return PuzzleDescription{}, io.EOF
+	}
+	puzzle, err := r.input.NextPuzzle()
+	if err == nil {
+		r.left--
+	}
+	return puzzle, err
+}
+
+//NumTilesFilter passes puzzles with numTiles tiles
+func NumTilesFilter(numTiles int) PuzzleFilter {
+	return func(puzzle *PuzzleDescription) bool {
+		return puzzle.Tiles != nil && len(*puzzle.Tiles) == numTiles
+	}
+}
+
+//PuzzleIDFilter passes puzzles with a puzzle_id in ids
+func PuzzleIDFilter(ids Ranges) PuzzleFilter {
+	return func(puzzle *PuzzleDescription) bool {
+		return ids.Contains(puzzle.PuzzleID)
+	}
+}
+
+//JobIDFilter passes jobs with a job_id in ids
+func JobIDFilter(ids Ranges) PuzzleFilter {
+	return func(puzzle *PuzzleDescription) bool {
+		return ids.Contains(puzzle.JobID)
+	}
+}
+
+//BoardWidthFilter passes puzzles with a board width in widths
+func BoardWidthFilter(widths Ranges) PuzzleFilter {
+	return func(puzzle *PuzzleDescription) bool {
+		return widths.Contains(puzzle.Board.X)
+	}
+}
+
+//BoardHeightFilter passes puzzles with a board height in heights
+func BoardHeightFilter(heights Ranges) PuzzleFilter {
+	return func(puzzle *PuzzleDescription) bool {
+		return heights.Contains(puzzle.Board.Y)
+	}
+}
+
+//Ranges is a list of inclusive integer ranges
+type Ranges []Range
+
+//Range contains the integers from Min up to and including Max
+type Range struct {
+	Min, Max int
+}
+
+//Contains returns whether value is in one of the ranges
+func (r Ranges) Contains(value int) bool {
+	for _, span := range r {
+		if value >= span.Min && value <= span.Max {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseRanges reads a comma separated list of numbers and ranges, like "1,5-10,20-". A range without a start begins
+//at 0, one without an end has no upper limit. An empty string gives no ranges.
+func ParseRanges(s string) (Ranges, error) {
+	var ranges Ranges
+	if strings.TrimSpace(s) == "" {
+		return ranges, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		span := Range{Min: 0, Max: int(^uint(0) >> 1)}
+		var err error
+		if bounds[0] != "" {
+			if span.Min, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+				return nil, fmt.Errorf("invalid range %q: %v", part, err)
+			}
+		}
+		if len(bounds) == 1 {
+			span.Max = span.Min
+		} else if bounds[1] = strings.TrimSpace(bounds[1]); bounds[1] != "" {
+			if span.Max, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid range %q: %v", part, err)
+			}
+		}
+		if bounds[0] == "" && len(bounds) == 1 || span.Max < span.Min {
+			return nil, fmt.Errorf("invalid range %q", part)
+		}
+		ranges = append(ranges, span)
+	}
+	return ranges, nil
+}
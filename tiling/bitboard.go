@@ -0,0 +1,148 @@
+package tiling
+
+import (
+	"fmt"
+	"localhost/flobrm/tilingsolver/core"
+	"math/bits"
+)
+
+//Ways to keep track of the occupied cells of a board, see Options.Occupancy
+const (
+	OccupancyAuto     = "auto"     //bitboard for boards up to maxBitboardSide, grid for larger boards
+	OccupancyGrid     = "grid"     //walk the tile outlines in the cell grid, tile by tile
+	OccupancyBitboard = "bitboard" //measure gaps with a bitset per row and the height of each column
+)
+
+//maxBitboardSide is the longest board side OccupancyAuto uses a bitboard for, longer rows take more than one word
+const maxBitboardSide = 64
+
+//validOccupancy checks if occupancy is one of the Occupancy constants, the empty string is the same as grid
+func validOccupancy(occupancy string) error {
+	switch occupancy {
+	case "", OccupancyAuto, OccupancyGrid, OccupancyBitboard:
+		return nil
+	}
+	return fmt.Errorf("unknown occupancy %q, expected %s, %s or %s", occupancy, OccupancyAuto, OccupancyGrid,
+		OccupancyBitboard)
+}
+
+//useBitboard returns whether a board of size is measured with a bitboard under occupancy
+func useBitboard(occupancy string, size core.Coord) bool {
+	switch occupancy {
+	case OccupancyBitboard:
+		return true
+	case OccupancyAuto:
+		return size.X <= maxBitboardSide && size.Y <= maxBitboardSide
+	}
+	return false
+}
+
+//bitboard stores the occupied cells of every row as a bitset, and the skyline: the height up to which each column is
+//filled. Tiles are only placed on a filled ledge at least as wide as the tile, so the occupied cells of a column never
+//have a hole below them and the skyline describes the columns exactly.
+//A ledge is then found by combining two rows a word at a time, and the height of a wall is a single lookup.
+type bitboard struct {
+	rowWords int
+	rows     []uint64 //row y is rows[y*rowWords:(y+1)*rowWords], bit x is cell (x, y)
+	skyline  []int    //the number of occupied cells at the bottom of each column
+}
+
+func newBitboard(size core.Coord) *bitboard {
+	rowWords := (size.X + 63) / 64
+	return &bitboard{
+		rowWords: rowWords,
+		rows:     make([]uint64, rowWords*size.Y),
+		skyline:  make([]int, size.X),
+	}
+}
+
+func (bb *bitboard) row(y int) []uint64 {
+	return bb.rows[y*bb.rowWords : (y+1)*bb.rowWords]
+}
+
+//fill marks the cells covered by tile as occupied
+func (bb *bitboard) fill(tile *Tile) {
+	if bb.rowWords == 1 {
+		mask := ^uint64(0) >> uint(64-tile.CurW) << uint(tile.X)
+		rows := bb.rows[tile.Y : tile.Y+tile.CurH]
+		for y := range rows {
+			rows[y] |= mask
+		}
+	} else {
+		for y := tile.Y; y < tile.Y+tile.CurH; y++ {
+			setBits(bb.row(y), tile.X, tile.CurW, true)
+		}
+	}
+	top := tile.Y + tile.CurH
+	columns := bb.skyline[tile.X : tile.X+tile.CurW]
+	for x := range columns {
+		columns[x] = top
+	}
+}
+
+//clear marks the cells covered by tile as empty, tile must be the last tile placed in its columns
+func (bb *bitboard) clear(tile *Tile) {
+	if bb.rowWords == 1 {
+		mask := ^uint64(0) >> uint(64-tile.CurW) << uint(tile.X)
+		rows := bb.rows[tile.Y : tile.Y+tile.CurH]
+		for y := range rows {
+			rows[y] &^= mask
+		}
+	} else {
+		for y := tile.Y; y < tile.Y+tile.CurH; y++ {
+			setBits(bb.row(y), tile.X, tile.CurW, false)
+		}
+	}
+	columns := bb.skyline[tile.X : tile.X+tile.CurW]
+	for x := range columns {
+		columns[x] = tile.Y
+	}
+}
+
+//ledgeWidth is the number of cells from pos to the right that are empty, with an occupied cell below them
+func (bb *bitboard) ledgeWidth(pos *core.Coord) int {
+	if bb.rowWords == 1 {
+		return bits.TrailingZeros64(^((bb.rows[pos.Y-1] &^ bb.rows[pos.Y]) >> uint(pos.X)))
+	}
+	return supportedRun(bb.row(pos.Y-1), bb.row(pos.Y), pos.X)
+}
+
+//wallHeight is the number of cells from y up in column open that are empty, next to an occupied cell in column wall
+func (bb *bitboard) wallHeight(wall, open, y int) int {
+	if bb.skyline[open] > y || bb.skyline[wall] < y {
+		return 0
+	}
+	return bb.skyline[wall] - y
+}
+
+//setBits sets or clears n bits of set from bit start on
+func setBits(set []uint64, start, n int, value bool) {
+	for n > 0 {
+		word, shift := start/64, uint(start%64)
+		length := Min(n, 64-int(shift))
+		mask := ^uint64(0) >> uint(64-length) << shift
+		if value {
+			set[word] |= mask
+		} else {
+			set[word] &^= mask
+		}
+		start += length
+		n -= length
+	}
+}
+
+//supportedRun counts the bits from start on that are set in support and not in open, until the first one that isn't.
+//Bits past the end of the board are never set, so the run always ends at the board edge.
+func supportedRun(support, open []uint64, start int) int {
+	run := 0
+	shift := uint(start % 64)
+	for word := start / 64; word < len(support); word++ {
+		ones := bits.TrailingZeros64(^((support[word] &^ open[word]) >> shift))
+		if ones < 64-int(shift) {
+			return run + ones
+		}
+		run += 64 - int(shift)
+		shift = 0
+	}
+	return run
+}
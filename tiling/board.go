@@ -1,9 +1,17 @@
 package tiling
 
 import (
+	"fmt"
 	"localhost/flobrm/tilingsolver/core"
+	"math"
 )
 
+//maxCompactTiles is the largest number of tiles that fits in the uint8 board, cells store the tile number + 1
+const maxCompactTiles = math.MaxUint8
+
+//MaxTiles is the largest number of tiles a Board can hold
+const MaxTiles = math.MaxInt32 - 1
+
 //Board stores the board and everything placed on it
 type Board struct {
 	Size  core.Coord //width and hight of the board
@@ -11,36 +19,82 @@ type Board struct {
 	// Candidates []gap
 	candidates candidateList
 	// Candidates    []core.Coord //Candidate positions for next placement
-	board         [][]uint8 // first x then y
-	gapTable      [][][]int //lookup table for impossible gaps, in order width, height, tileIndex
-	maxGapTable   [][]int   //lookup table with maximum possible area for a gap of a certain width and height, given a full tileset
-	lastCollision *Tile
+	board           [][]uint8 // first x then y, the number of the tile on the cell + 1, or 0 if it's empty
+	wideBoard       [][]int32 // replaces board for puzzles with more than maxCompactTiles tiles
+	occupied        *bitboard // if set, gaps are measured with this instead of walking the board
+	gapTable        [][][]int //lookup table for impossible gaps, in order width, height, tileIndex
+	maxGapTable     [][]int   //lookup table with maximum possible area for a gap of a certain width and height, given a full tileset
+	sideGapTable    [][][]int //gapTable for gaps on the left side of tiles, with height and width swapped
+	maxSideGapTable [][]int   //maxGapTable for gaps on the left side of tiles, with height and width swapped
+	lastCollision   *Tile
+	stats           *SearchStats //if set, counts the placements each rule rejects
 }
 
-//NewBoard inits a board, including candidates
-func NewBoard(boardDims core.Coord, tiles []Tile, placementOrder int) Board {
+//NewBoard inits a board, including candidates. It returns an error if the board can't hold the puzzle.
+//occupancy is one of the Occupancy constants.
+func NewBoard(boardDims core.Coord, tiles []Tile, placementOrder int, occupancy string) (Board, error) {
+	if boardDims.X <= 0 || boardDims.Y <= 0 {
+		return Board{}, fmt.Errorf("invalid board size %dx%d", boardDims.X, boardDims.Y)
+	}
+	if len(tiles) > MaxTiles {
+		return Board{}, fmt.Errorf("puzzle has %d tiles, a board can hold at most %d", len(tiles), MaxTiles)
+	}
+	if err := validOccupancy(occupancy); err != nil {
+		return Board{}, err
+	}
 	myTiles := make([](*Tile), len(tiles))
 	firstGap := gap{Pos: core.Coord{}, W: boardDims.X, H: boardDims.Y, leftH: boardDims.Y, active: true, leftSideActive: true}
 	candidates := newCandidateList(len(tiles), placementOrder)
 	candidates.addCandidate(firstGap)
-	board := make([][]uint8, boardDims.X)
-	gapTable, maxGapTable := buildGapTable(tiles, boardDims.X, boardDims.Y) //TODO make this a variable
-
-	for i := 0; i < len(board); i++ {
-		board[i] = make([]uint8, boardDims.Y)
+	gapTable, maxGapTable := buildGapTable(tiles, boardDims.X, boardDims.Y, false) //TODO make this a variable
+	//left side gaps are looked up with height and width swapped, that only needs its own table if some tiles can't rotate
+	sideGapTable, maxSideGapTable := gapTable, maxGapTable
+	for _, tile := range tiles {
+		if tile.Rotation != core.RotationFree {
+			sideGapTable, maxSideGapTable = buildGapTable(tiles, boardDims.Y, boardDims.X, true)
+			break
+		}
 	}
-	return Board{
+
+	b := Board{
 		Size:  core.Coord{X: boardDims.X, Y: boardDims.Y},
 		Tiles: myTiles[:0],
 		//Candidates:  candidates,
-		candidates:  candidates,
-		board:       board,
-		gapTable:    gapTable,
-		maxGapTable: maxGapTable,
+		candidates:      candidates,
+		gapTable:        gapTable,
+		maxGapTable:     maxGapTable,
+		sideGapTable:    sideGapTable,
+		maxSideGapTable: maxSideGapTable,
+	}
+	//the compact board is faster, but can only number maxCompactTiles tiles
+	if len(tiles) <= maxCompactTiles {
+		b.board = make([][]uint8, boardDims.X)
+		for i := 0; i < len(b.board); i++ {
+			b.board[i] = make([]uint8, boardDims.Y)
+		}
+	} else {
+		b.wideBoard = make([][]int32, boardDims.X)
+		for i := 0; i < len(b.wideBoard); i++ {
+			b.wideBoard[i] = make([]int32, boardDims.Y)
+		}
+	}
+	if useBitboard(occupancy, boardDims) {
+		b.occupied = newBitboard(boardDims)
+	}
+	return b, nil
+}
+
+//owner returns the number of the tile on a cell + 1, or 0 if the cell is empty
+func (b *Board) owner(x, y int) int {
+	if b.board != nil {
+		return int(b.board[x][y])
 	}
+	return int(b.wideBoard[x][y])
 }
 
-func buildGapTable(tiles []Tile, maxGapWidth int, maxGapHeight int) ([][][]int, [][]int) {
+//buildGapTable computes for every gap size the largest area each tile can cover in it, taking the rotation of the tiles
+//into account. For a transposed table width and height are swapped, so a tile lies flat if it is placed turned in the table.
+func buildGapTable(tiles []Tile, maxGapWidth int, maxGapHeight int, transposed bool) ([][][]int, [][]int) {
 	gapTable := make([][][]int, maxGapWidth+1)
 	// gapTable := make([][]int, len(tiles))
 	maxGapArea := make([][]int, maxGapWidth+1)
@@ -52,15 +106,20 @@ func buildGapTable(tiles []Tile, maxGapWidth int, maxGapHeight int) ([][][]int,
 			// fmt.Print(height)
 			gapTable[width][height] = make([]int, len(tiles))
 			for _, tile := range tiles {
-				if tile.H <= width {
-					area := Min(tile.W, height) * tile.H
-					if tile.W <= width {
-						area = Max(area, tile.W*Min(tile.H, height))
-					}
-					gapTable[width][height][tile.Index] = area
-					maxGapArea[width][height] += area
-					// fmt.Println("w:", width, "h:", height, "tile", tile.W, tile.H, "area", area)
+				rotation := tile.Rotation
+				if transposed {
+					rotation = rotation.Transposed()
+				}
+				area := 0
+				if tile.H <= width && rotation.Allows(true) {
+					area = Min(tile.W, height) * tile.H
+				}
+				if tile.W <= width && rotation.Allows(false) {
+					area = Max(area, tile.W*Min(tile.H, height))
 				}
+				gapTable[width][height][tile.Index] = area
+				maxGapArea[width][height] += area
+				// fmt.Println("w:", width, "h:", height, "tile", tile.W, tile.H, "area", area)
 			}
 		}
 	}
@@ -99,28 +158,41 @@ func (b *Board) Place(tile *Tile, turned bool, checkFullSSN bool) bool {
 }
 
 //HasUnfillableGaps check in different ways if there are unfillable gaps on the board
-func (b *Board) HasUnfillableGaps(onlyNextCandidate bool, checkGapsFromLeft bool, checkTotalGapArea bool) bool {
+//checkAllGaps includes the next gap, so checkNextGap only matters if checkAllGaps is false
+func (b *Board) HasUnfillableGaps(checkNextGap bool, checkAllGaps bool, checkGapsFromLeft bool, checkTotalGapArea bool) bool {
 	if b.candidates.isEmpty() {
 		return false
 	}
-	if onlyNextCandidate {
+	if checkAllGaps {
+		if b.anyGapsUnfillable() {
+			if b.stats != nil {
+				b.stats.AllGaps++
+			}
+			return true
+		}
+	} else if checkNextGap {
 		// nextGap := &b.Candidates[len(b.Candidates)-1]
 		nextGap := b.candidates.nextGap()
 		if b.gapIsUnfillable(nextGap) {
-			return true
-		}
-	} else {
-		if b.anyGapsUnfillable() {
+			if b.stats != nil {
+				b.stats.NextGap++
+			}
 			return true
 		}
 	}
 	if checkGapsFromLeft {
 		if b.hasUnfillableLeftSideGaps() {
+			if b.stats != nil {
+				b.stats.LeftSideGaps++
+			}
 			return true
 		}
 	}
 	if checkTotalGapArea {
 		if b.totalGapAreaTooBig() {
+			if b.stats != nil {
+				b.stats.TotalGapArea++
+			}
 			return true
 		}
 	}
@@ -136,11 +208,17 @@ func (b *Board) fits(tile *Tile, turned bool, checkFullSSN bool) bool {
 
 	tile.Place(gap.Pos, turned)
 	if !b.tileFitsBoard(tile) {
+		if b.stats != nil {
+			b.stats.BoardBounds++
+		}
 		tile.Remove()
 		return false
 	}
 
 	if !gap.couldFit(tile) {
+		if b.stats != nil {
+			b.stats.GapWidth++
+		}
 		tile.Remove()
 		return false
 	}
@@ -149,6 +227,9 @@ func (b *Board) fits(tile *Tile, turned bool, checkFullSSN bool) bool {
 	if len(b.Tiles) > 0 && tile.Index < b.Tiles[0].Index {
 		corner := b.isCornerTile(tile)
 		if corner != noCorner && corner != bottomLeftCorner {
+			if b.stats != nil {
+				b.stats.CornerRule++
+			}
 			tile.Remove()
 			return false
 		}
@@ -160,6 +241,9 @@ func (b *Board) fits(tile *Tile, turned bool, checkFullSSN bool) bool {
 	if checkFullSSN {
 		notIllegalPair := b.updateNeighborsTree(tile)
 		if !notIllegalPair {
+			if b.stats != nil {
+				b.stats.SSNTree++
+			}
 			b.removeTileFromPairTree(tile)
 			tile.Remove()
 			return false
@@ -207,9 +291,12 @@ func (b *Board) leftGapHeight(pos *core.Coord) int {
 	if pos.X == 0 {
 		return b.Size.Y - pos.Y
 	}
+	if b.occupied != nil {
+		return b.occupied.wallHeight(pos.X-1, pos.X, pos.Y)
+	}
 	leftY := pos.Y
-	for leftY < b.Size.Y && b.board[pos.X-1][leftY] != 0 && b.board[pos.X][leftY] == 0 {
-		index := b.board[pos.X-1][leftY] - 1
+	for leftY < b.Size.Y && b.owner(pos.X-1, leftY) != 0 && b.owner(pos.X, leftY) == 0 {
+		index := b.owner(pos.X-1, leftY) - 1
 		leftY = b.Tiles[index].Y + b.Tiles[index].CurH
 	}
 	return leftY - pos.Y
@@ -220,9 +307,12 @@ func (b *Board) rightGapHeight(pos *core.Coord, width int) int {
 	if rightX >= b.Size.X {
 		return b.Size.Y - pos.Y
 	}
+	if b.occupied != nil {
+		return b.occupied.wallHeight(rightX, rightX-1, pos.Y)
+	}
 	curY := pos.Y
-	for curY < b.Size.Y && b.board[rightX][curY] != 0 && b.board[rightX-1][curY] == 0 {
-		index := b.board[rightX][curY] - 1
+	for curY < b.Size.Y && b.owner(rightX, curY) != 0 && b.owner(rightX-1, curY) == 0 {
+		index := b.owner(rightX, curY) - 1
 		curY = b.Tiles[index].Y + b.Tiles[index].CurH
 	}
 
@@ -233,9 +323,12 @@ func (b *Board) gapWidth(pos *core.Coord) int {
 	if pos.Y == 0 {
 		return b.Size.X - pos.X //TODO actually check board, instead of assuming
 	}
+	if b.occupied != nil {
+		return b.occupied.ledgeWidth(pos)
+	}
 	xPos := pos.X
-	for xPos < b.Size.X && b.board[xPos][pos.Y-1] != 0 && b.board[xPos][pos.Y] == 0 {
-		index := b.board[xPos][pos.Y-1] - 1
+	for xPos < b.Size.X && b.owner(xPos, pos.Y-1) != 0 && b.owner(xPos, pos.Y) == 0 {
+		index := b.owner(xPos, pos.Y-1) - 1
 		xPos = b.Tiles[index].X + b.Tiles[index].CurW
 	}
 	return xPos - pos.X
@@ -310,16 +403,16 @@ func (b *Board) leftSideGapIsUnfillable(g *gap) bool {
 	width := g.leftH
 	height := g.W
 	//first check if our lookup tables contain a gap of those dimensions
-	if width+1 > len(b.gapTable) || height+1 > len(b.gapTable[0]) {
+	if width+1 > len(b.sideGapTable) || height+1 > len(b.sideGapTable[0]) {
 		return false
 	}
 	targetArea := width * height
-	maxArea := b.maxGapTable[width][height]
+	maxArea := b.maxSideGapTable[width][height]
 	if maxArea < targetArea {
 		return true
 	}
 	for _, tile := range b.Tiles { // remove the areas of already placed tiles
-		maxArea -= b.gapTable[width][height][tile.Index]
+		maxArea -= b.sideGapTable[width][height][tile.Index]
 	}
 	return maxArea < targetArea
 }
@@ -391,30 +484,47 @@ func (b *Board) placeTile(tile *Tile, turned bool) {
 }
 
 func (b *Board) putTileOnBoard(tile *Tile) {
-	index := uint8(len(b.Tiles) + 1)
-	tileTop := tile.Y + tile.CurH - 1
-	for x := tile.X; x < tile.X+tile.CurW; x++ {
-		b.board[x][tile.Y] = index
-		b.board[x][tileTop] = index
-	}
-	tileRightEdge := tile.X + tile.CurW - 1
-	for y := tile.Y + 1; y < tile.Y+tile.CurH-1; y++ {
-		b.board[tile.X][y] = index
-		b.board[tileRightEdge][y] = index
+	b.markOutline(tile, len(b.Tiles)+1)
+	if b.occupied != nil {
+		b.occupied.fill(tile)
 	}
 }
 
 func (b *Board) removeTileFromBoard(tile *Tile) {
-	index := uint8(0)
-	tileTop := tile.Y + tile.CurH - 1
-	for x := tile.X; x < tile.X+tile.CurW; x++ {
-		b.board[x][tile.Y] = index
-		b.board[x][tileTop] = index
+	b.markOutline(tile, 0)
+	if b.occupied != nil {
+		b.occupied.clear(tile)
+	}
+}
+
+//markOutline sets the owner of the cells on the edges of tile, the inside of a tile is never looked at
+func (b *Board) markOutline(tile *Tile, owner int) {
+	left, right := tile.X, tile.X+tile.CurW-1
+	bottom, top := tile.Y, tile.Y+tile.CurH-1
+	if b.board != nil {
+		value := uint8(owner)
+		for x := left; x <= right; x++ {
+			column := b.board[x]
+			column[bottom] = value
+			column[top] = value
+		}
+		leftColumn, rightColumn := b.board[left], b.board[right]
+		for y := bottom + 1; y < top; y++ {
+			leftColumn[y] = value
+			rightColumn[y] = value
+		}
+		return
 	}
-	tileRightEdge := tile.X + tile.CurW - 1
-	for y := tile.Y + 1; y < tile.Y+tile.CurH-1; y++ {
-		b.board[tile.X][y] = index
-		b.board[tileRightEdge][y] = index
+	value := int32(owner)
+	for x := left; x <= right; x++ {
+		column := b.wideBoard[x]
+		column[bottom] = value
+		column[top] = value
+	}
+	leftColumn, rightColumn := b.wideBoard[left], b.wideBoard[right]
+	for y := bottom + 1; y < top; y++ {
+		leftColumn[y] = value
+		rightColumn[y] = value
 	}
 }
 
@@ -424,9 +534,9 @@ func (b *Board) addCandidates(tile Tile) {
 	if candidateY < b.Size.Y {
 		if tile.X == 0 { //left border counts as corner
 			b.addCandidate(b.makeNewGap(&core.Coord{X: 0, Y: candidateY}))
-		} else if b.board[tile.X-1][candidateY] != 0 {
+		} else if b.owner(tile.X-1, candidateY) != 0 {
 			for x := tile.X; x < tile.X+tile.CurW; x++ {
-				if b.board[x][candidateY] == 0 {
+				if b.owner(x, candidateY) == 0 {
 					b.addCandidate(b.makeNewGap(&core.Coord{X: x, Y: candidateY}))
 					break
 				}
@@ -439,9 +549,9 @@ func (b *Board) addCandidates(tile Tile) {
 	if candidateX < b.Size.X {
 		if tile.Y == 0 { //always add candidate if tile on bottom
 			b.addCandidate(b.makeNewGap(&core.Coord{X: candidateX, Y: 0}))
-		} else if b.board[candidateX][tile.Y-1] != 0 {
+		} else if b.owner(candidateX, tile.Y-1) != 0 {
 			for y := tile.Y; y < tile.Y+tile.CurH; y++ {
-				if b.board[candidateX][y] == 0 {
+				if b.owner(candidateX, y) == 0 {
 					b.addCandidate(b.makeNewGap(&core.Coord{X: candidateX, Y: y}))
 					break
 				}
@@ -497,43 +607,6 @@ const (
 	topRightCorner    = iota
 )
 
-//GetCanonicalSolution returns a slice of tiles as placed on the current board
-//but flips the board so the corner with the largest tile is bottom right.
-func (b *Board) GetCanonicalSolution(tiles *[]Tile) int { //TODO fix to use grid
-	var largestCornerTile *Tile
-	var largestCorner = bottomLeftCorner
-	//first determine what the largest corner is
-	for i, tile := range *tiles {
-		corner := b.isCornerTile(&tile)
-		if corner != noCorner {
-			if largestCornerTile == nil {
-				largestCornerTile = &(*tiles)[i]
-				largestCorner = corner
-			} else if tile.W > largestCornerTile.W ||
-				tile.W == largestCornerTile.W && tile.Y > largestCornerTile.Y {
-				largestCornerTile = &(*tiles)[i]
-				largestCorner = corner
-			}
-		}
-	}
-
-	//Second flip the tiles depending on the largest corner
-	if largestCorner == bottomLeftCorner {
-		//Do nothing
-	} else if largestCorner == bottomRightCorner {
-		b.flipTilesHorizontally(tiles)
-		return 1
-	} else if largestCorner == topLeftCorner {
-		b.flipTilesVertically(tiles)
-		return 1
-	} else { //TOP_RIGHT_CORNER
-		b.flipTilesHorizontally(tiles)
-		b.flipTilesVertically(tiles)
-		return 1
-	}
-	return 0
-}
-
 //isCornerTile checks if t is a corner on the current board.
 //It returns one of the constants ending in CORNER.
 func (b *Board) isCornerTile(t *Tile) int {
@@ -550,21 +623,6 @@ func (b *Board) isCornerTile(t *Tile) int {
 	}
 }
 
-func (b *Board) flipTilesHorizontally(tiles *[]Tile) *[]Tile {
-	for i := range *tiles {
-		// tile2.X = b.Size.X - tile2.X - tile2.CurW
-		(*tiles)[i].X = b.Size.X - (*tiles)[i].X - (*tiles)[i].CurW
-	}
-	return tiles
-}
-
-func (b *Board) flipTilesVertically(tiles *[]Tile) *[]Tile {
-	for i := range *tiles {
-		(*tiles)[i].Y = b.Size.Y - (*tiles)[i].Y - (*tiles)[i].CurH
-	}
-	return tiles
-}
-
 func (b *Board) addTilePair(t1 *Tile, t2 *Tile) {
 	var X, Y, W, H int
 	X = Min(t1.X, t2.X)
@@ -578,7 +636,10 @@ func (b *Board) addTilePair(t1 *Tile, t2 *Tile) {
 	}
 	parent := NewTile(W, H)
 	parent.Place(core.Coord{X: X, Y: Y}, false)
-	parent.Index = Max(t1.Index, t2.Index) //TODO should this be min or max?
+	//the pair counts as its smallest tile, so the smallest tile of a group ends up in its bottom left corner, like the
+	//corner rule wants the smallest corner tile in the bottom left corner of the board. With the largest tile the two rules
+	//can contradict each other and reject every version of a solution.
+	parent.Index = Min(t1.Index, t2.Index)
 	parent.lChild = t1
 	parent.rChild = t2
 	t1.parent = &parent
@@ -589,8 +650,8 @@ func (b *Board) addTilePair(t1 *Tile, t2 *Tile) {
 func (b *Board) updateNeighborsTree(tile *Tile) bool {
 	for tileAddition := tile; tileAddition != nil; tileAddition = tileAddition.parent {
 		//check bottom
-		if tileAddition.Y > 0 && b.board[tileAddition.X][tileAddition.Y-1] > 0 {
-			otherIndex := b.board[tileAddition.X][tileAddition.Y-1] - 1
+		if tileAddition.Y > 0 && b.owner(tileAddition.X, tileAddition.Y-1) > 0 {
+			otherIndex := b.owner(tileAddition.X, tileAddition.Y-1) - 1
 			for other := b.Tiles[otherIndex]; other != nil; other = other.parent {
 				if other.X == tileAddition.X && other.CurW == tileAddition.CurW {
 					if other.Index > tileAddition.Index {
@@ -615,8 +676,8 @@ func (b *Board) updateNeighborsTree(tile *Tile) bool {
 		}
 
 		//check left
-		if tileAddition.X > 0 && b.board[tileAddition.X-1][tileAddition.Y] > 0 {
-			otherIndex := b.board[tileAddition.X-1][tileAddition.Y] - 1
+		if tileAddition.X > 0 && b.owner(tileAddition.X-1, tileAddition.Y) > 0 {
+			otherIndex := b.owner(tileAddition.X-1, tileAddition.Y) - 1
 			for other := b.Tiles[otherIndex]; other != nil; other = other.parent {
 				if other.Y == tileAddition.Y && other.CurH == tileAddition.CurH {
 					if other.Index > tileAddition.Index {
@@ -636,8 +697,8 @@ func (b *Board) updateNeighborsTree(tile *Tile) bool {
 		}
 
 		//check right
-		if tileAddition.X+tileAddition.CurW < b.Size.X-1 && b.board[tileAddition.X+tileAddition.CurW][tileAddition.Y] > 0 {
-			otherIndex := b.board[tileAddition.X+tileAddition.CurW][tileAddition.Y] - 1
+		if tileAddition.X+tileAddition.CurW < b.Size.X-1 && b.owner(tileAddition.X+tileAddition.CurW, tileAddition.Y) > 0 {
+			otherIndex := b.owner(tileAddition.X+tileAddition.CurW, tileAddition.Y) - 1
 			for other := b.Tiles[otherIndex]; other != nil; other = other.parent {
 				if other.Y == tileAddition.Y && other.CurH == tileAddition.CurH {
 					if other.Index < tileAddition.Index {
@@ -657,8 +718,8 @@ func (b *Board) updateNeighborsTree(tile *Tile) bool {
 		}
 
 		//check top
-		if tileAddition.Y+tileAddition.CurH < b.Size.Y-1 && b.board[tileAddition.X][tileAddition.Y+tileAddition.CurH] > 0 {
-			otherIndex := b.board[tileAddition.X][tileAddition.Y-1] - 1
+		if tileAddition.Y+tileAddition.CurH < b.Size.Y-1 && b.owner(tileAddition.X, tileAddition.Y+tileAddition.CurH) > 0 {
+			otherIndex := b.owner(tileAddition.X, tileAddition.Y-1) - 1
 			for other := b.Tiles[otherIndex]; other != nil; other = other.parent {
 				if other.X == tileAddition.X && other.CurW == tileAddition.CurW {
 					if other.Index < tileAddition.Index {
@@ -0,0 +1,232 @@
+package tiling
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+//ssnPuzzles have groups of tiles with the same side that span the board, where the same side neighbor check and the
+//corner rule both choose which version of a solution is searched
+var ssnPuzzles = []testPuzzle{
+	{"column of small tiles next to a large one", core.Puzzle{
+		Board: core.Coord{X: 6, Y: 10},
+		Tiles: []core.Coord{{X: 1, Y: 1}, {X: 10, Y: 5}, {X: 1, Y: 2}, {X: 1, Y: 1}, {X: 4, Y: 1}, {X: 1, Y: 1},
+			{X: 1, Y: 1}},
+	}},
+	{"columns of the full board height", core.Puzzle{
+		Board: core.Coord{X: 11, Y: 12},
+		Tiles: []core.Coord{{X: 4, Y: 4}, {X: 2, Y: 12}, {X: 3, Y: 2}, {X: 4, Y: 8}, {X: 2, Y: 12}, {X: 3, Y: 10}},
+	}},
+	{"rows of the full board width", core.Puzzle{
+		Board: core.Coord{X: 8, Y: 6},
+		Tiles: []core.Coord{{X: 4, Y: 1}, {X: 2, Y: 1}, {X: 8, Y: 1}, {X: 8, Y: 4}, {X: 1, Y: 1}, {X: 1, Y: 1}},
+	}},
+}
+
+//TestSameSideNeighborCheck checks that the check only leaves out solutions, and keeps at least one
+func TestSameSideNeighborCheck(t *testing.T) {
+	puzzles := append(append([]testPuzzle(nil), ssnPuzzles...), rotationPuzzles...)
+	noSSN := DefaultOptions()
+	noSSN.FullSSNCheck = false
+	for _, test := range puzzles {
+		all := make(map[string]bool)
+		for _, solution := range solveAll(t, NaiveSolver{}, test.puzzle, noSSN) {
+			all[solution] = true
+		}
+		if len(all) == 0 {
+			t.Fatalf("%s: no solutions without the check", test.name)
+		}
+		solutions := solveAll(t, NaiveSolver{}, test.puzzle, DefaultOptions())
+		if len(solutions) == 0 {
+			t.Errorf("%s: the check rejects all %d solutions", test.name, len(all))
+		}
+		for _, solution := range solutions {
+			if !all[solution] {
+				t.Errorf("%s: solution %s isn't found without the check", test.name, solution)
+			}
+		}
+	}
+}
+
+//lostClassPuzzles are puzzles where the check kept no version of a solution when a pair of same side neighbors counted
+//as its largest tile
+var lostClassPuzzles = []testPuzzle{
+	{"row of the full board width", core.Puzzle{ //4 solutions, none with the largest tile
+		Board: core.Coord{X: 10, Y: 8},
+		Tiles: []core.Coord{{X: 2, Y: 2}, {X: 2, Y: 10}, {X: 10, Y: 2}, {X: 4, Y: 2}, {X: 2, Y: 10}, {X: 2, Y: 2},
+			{X: 2, Y: 2}},
+	}},
+	{"column of the full board height", core.Puzzle{ //9 solutions, none with the largest tile
+		Board: core.Coord{X: 7, Y: 8},
+		Tiles: []core.Coord{{X: 3, Y: 1}, {X: 4, Y: 8}, {X: 8, Y: 2}, {X: 4, Y: 1}, {X: 1, Y: 1}},
+	}},
+	{"two columns of the full board height", core.Puzzle{ //6 solutions, none with the largest tile
+		Board: core.Coord{X: 4, Y: 11},
+		Tiles: []core.Coord{{X: 1, Y: 4}, {X: 3, Y: 1}, {X: 1, Y: 11}, {X: 2, Y: 11}, {X: 1, Y: 4}},
+	}},
+	{"small tiles next to a large one", core.Puzzle{ //23 solutions in 3 classes, 1 class with the largest tile
+		Board: core.Coord{X: 7, Y: 4},
+		Tiles: []core.Coord{{X: 1, Y: 1}, {X: 3, Y: 6}, {X: 2, Y: 1}, {X: 2, Y: 1}, {X: 4, Y: 1}, {X: 1, Y: 1}},
+	}},
+}
+
+//randomGuillotinePuzzle cuts a random board into tiles with straight cuts from side to side, and shuffles and turns the
+//tiles
+func randomGuillotinePuzzle(rng *rand.Rand) core.Puzzle {
+	board := core.Coord{X: 4 + rng.Intn(8), Y: 4 + rng.Intn(8)}
+	tiles := []core.Coord{board}
+	for numTiles := 5 + rng.Intn(3); len(tiles) < numTiles; {
+		i := rng.Intn(len(tiles))
+		tile := tiles[i]
+		if rng.Intn(2) == 0 && tile.X > 1 {
+			cut := 1 + rng.Intn(tile.X-1)
+			tiles[i] = core.Coord{X: cut, Y: tile.Y}
+			tiles = append(tiles, core.Coord{X: tile.X - cut, Y: tile.Y})
+		} else if tile.Y > 1 {
+			cut := 1 + rng.Intn(tile.Y-1)
+			tiles[i] = core.Coord{X: tile.X, Y: cut}
+			tiles = append(tiles, core.Coord{X: tile.X, Y: tile.Y - cut})
+		}
+	}
+	for i := range tiles {
+		if rng.Intn(2) == 0 {
+			tiles[i] = core.Coord{X: tiles[i].Y, Y: tiles[i].X}
+		}
+	}
+	rng.Shuffle(len(tiles), func(i, j int) { tiles[i], tiles[j] = tiles[j], tiles[i] })
+	return core.Puzzle{Board: board, Tiles: tiles}
+}
+
+//blockTiles returns the tiles inside the rectangle from (x0, y0) to (x1, y1), and whether they fill it exactly
+func blockTiles(tiles []Tile, x0, y0, x1, y1 int) ([]int, bool) {
+	var inside []int
+	area := 0
+	for i, tile := range tiles {
+		w, h := placedWidth(tile), placedHeight(tile)
+		if tile.X >= x1 || tile.X+w <= x0 || tile.Y >= y1 || tile.Y+h <= y0 {
+			continue
+		}
+		if tile.X < x0 || tile.X+w > x1 || tile.Y < y0 || tile.Y+h > y1 {
+			return nil, false
+		}
+		inside = append(inside, i)
+		area += w * h
+	}
+	return inside, area == (x1-x0)*(y1-y0)
+}
+
+//swappedNeighbors returns every solution made from tiles by swapping two blocks of tiles that share a whole side, the
+//solutions the same side neighbor check chooses between
+func swappedNeighbors(boardDims core.Coord, tiles []Tile) [][]Tile {
+	//blocks start and end where tiles start
+	lefts, bottoms := map[int]bool{boardDims.X: true}, map[int]bool{boardDims.Y: true}
+	for _, tile := range tiles {
+		lefts[tile.X] = true
+		bottoms[tile.Y] = true
+	}
+	var xs, ys []int
+	for x := range lefts {
+		xs = append(xs, x)
+	}
+	for y := range bottoms {
+		ys = append(ys, y)
+	}
+	sort.Ints(xs)
+	sort.Ints(ys)
+	var swapped [][]Tile
+	swap := func(first, second []int, moveFirst, moveSecond core.Coord) {
+		solution := append([]Tile(nil), tiles...)
+		for _, i := range first {
+			solution[i].X += moveFirst.X
+			solution[i].Y += moveFirst.Y
+		}
+		for _, i := range second {
+			solution[i].X -= moveSecond.X
+			solution[i].Y -= moveSecond.Y
+		}
+		swapped = append(swapped, solution)
+	}
+	for _, x0 := range xs {
+		for _, x1 := range xs {
+			for _, y0 := range ys {
+				for _, y1 := range ys {
+					if x0 >= x1 || y0 >= y1 {
+						continue
+					}
+					first, ok := blockTiles(tiles, x0, y0, x1, y1)
+					if !ok {
+						continue
+					}
+					for _, x2 := range xs { //right of the block
+						if second, ok := blockTiles(tiles, x1, y0, x2, y1); x2 > x1 && ok {
+							swap(first, second, core.Coord{X: x2 - x1}, core.Coord{X: x1 - x0})
+						}
+					}
+					for _, y2 := range ys { //above the block
+						if second, ok := blockTiles(tiles, x0, y1, x1, y2); y2 > y1 && ok {
+							swap(first, second, core.Coord{Y: y2 - y1}, core.Coord{Y: y1 - y0})
+						}
+					}
+				}
+			}
+		}
+	}
+	return swapped
+}
+
+//solutionClasses numbers the classes of solutions that can be turned into each other by swapping neighbors, and returns
+//the class of every solution in them
+func solutionClasses(t *testing.T, puzzle core.Puzzle, solutions []string) map[string]int {
+	t.Helper()
+	classes := make(map[string]int)
+	numClasses := 0
+	for _, solution := range solutions {
+		if _, ok := classes[solution]; ok {
+			continue
+		}
+		classes[solution] = numClasses
+		for queue := []string{solution}; len(queue) > 0; queue = queue[1:] {
+			for _, swapped := range swappedNeighbors(puzzle.Board, solutionTiles(t, puzzle, queue[0])) {
+				key := TileSliceToJSON(CanonicalSolution(puzzle.Board, swapped))
+				if _, ok := classes[key]; !ok {
+					classes[key] = numClasses
+					queue = append(queue, key)
+				}
+			}
+		}
+		numClasses++
+	}
+	return classes
+}
+
+//checkSSNKeepsEveryClass checks that the check keeps a solution of every class of solutions found without it
+func checkSSNKeepsEveryClass(t *testing.T, name string, puzzle core.Puzzle) {
+	t.Helper()
+	noSSN := DefaultOptions()
+	noSSN.FullSSNCheck = false
+	all := solveAll(t, NaiveSolver{}, puzzle, noSSN)
+	classes := solutionClasses(t, puzzle, all)
+	kept := make(map[int]bool)
+	for _, solution := range solveAll(t, NaiveSolver{}, puzzle, DefaultOptions()) {
+		kept[classes[solution]] = true
+	}
+	for _, solution := range all {
+		if class := classes[solution]; !kept[class] {
+			t.Errorf("%s, board %v with tiles %v: the check rejects every version of %s", name, puzzle.Board,
+				puzzle.Tiles, solution)
+			kept[class] = true
+		}
+	}
+}
+
+func TestSameSideNeighborCheckKeepsEveryClass(t *testing.T) {
+	for _, test := range lostClassPuzzles {
+		checkSSNKeepsEveryClass(t, test.name, test.puzzle)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		checkSSNKeepsEveryClass(t, "random puzzle", randomGuillotinePuzzle(rng))
+	}
+}
@@ -0,0 +1,154 @@
+package tiling
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+)
+
+//CanonicalSolution returns the canonical form of a solution on a board of boardDims.
+//Of all versions of the solution under the symmetries of the board, the mirror images and for square boards also the
+//rotations, it picks the one with the smallest tile positions, compared by X then Y in tile order.
+//Tiles of the same size and Rotation, taken with their longest side as width, are interchangeable, so their positions
+//are sorted over them first. The result doesn't depend on the order the tiles were placed in, or on which version of
+//the solution is passed.
+//Rotations of a square board are left out if a tile that isn't square can't rotate, they would turn that tile.
+//Every tile needs W, H, X, Y and Turned, the result is a new slice with the tiles in the same order.
+func CanonicalSolution(boardDims core.Coord, tiles []Tile) []Tile {
+	canonical := make([]Tile, len(tiles))
+	newCanonicalizer(boardDims, tiles).canonicalize(tiles, canonical)
+	return canonical
+}
+
+//placedRect is the area a tile covers on the board
+type placedRect struct {
+	x, y, w, h int
+}
+
+//boardSymmetry maps a board onto itself, by transposing it first and then mirroring it
+type boardSymmetry struct {
+	transpose, mirrorX, mirrorY bool
+}
+
+//canonicalizer computes canonical solutions of one puzzle, it reuses its buffers between solutions
+type canonicalizer struct {
+	boardDims  core.Coord
+	symmetries []boardSymmetry
+	sameSize   [][]int //indexes of tiles with the same size and rotation, in increasing order
+	rects      []placedRect
+	sorted     []placedRect
+	candidate  []Tile
+}
+
+func newCanonicalizer(boardDims core.Coord, tiles []Tile) *canonicalizer {
+	c := canonicalizer{
+		boardDims: boardDims,
+		rects:     make([]placedRect, len(tiles)),
+		sorted:    make([]placedRect, 0, len(tiles)),
+		candidate: make([]Tile, len(tiles)),
+	}
+	fixedRotation := false
+	for i := range tiles {
+		if tiles[i].Rotation != core.RotationFree && tiles[i].W != tiles[i].H {
+			fixedRotation = true
+		}
+	}
+	for _, transpose := range []bool{false, true} {
+		if transpose && (boardDims.X != boardDims.Y || fixedRotation) {
+			break
+		}
+		for _, mirrorX := range []bool{false, true} {
+			for _, mirrorY := range []bool{false, true} {
+				c.symmetries = append(c.symmetries, boardSymmetry{transpose: transpose, mirrorX: mirrorX, mirrorY: mirrorY})
+			}
+		}
+	}
+	type tileKind struct {
+		size     core.Coord
+		rotation core.Rotation
+	}
+	groups := make(map[tileKind]int)
+	for i := range tiles {
+		kind := tileKind{
+			size:     core.Coord{X: Max(tiles[i].W, tiles[i].H), Y: Min(tiles[i].W, tiles[i].H)},
+			rotation: tiles[i].Rotation,
+		}
+		//the rotation is compared for the tile with its longest side as W, so both tiles of a group allow the same footprints
+		if tiles[i].W < tiles[i].H {
+			kind.rotation = kind.rotation.Transposed()
+		} else if tiles[i].W == tiles[i].H {
+			kind.rotation = core.RotationFree
+		}
+		group, ok := groups[kind]
+		if !ok {
+			group = len(c.sameSize)
+			groups[kind] = group
+			c.sameSize = append(c.sameSize, nil)
+		}
+		c.sameSize[group] = append(c.sameSize[group], i)
+	}
+	return &c
+}
+
+//canonicalize writes the canonical form of tiles to canonical, which must have the same length
+func (c *canonicalizer) canonicalize(tiles []Tile, canonical []Tile) {
+	for i, symmetry := range c.symmetries {
+		c.apply(symmetry, tiles, c.candidate)
+		if i == 0 || lessSolution(c.candidate, canonical) {
+			copy(canonical, c.candidate)
+		}
+	}
+}
+
+//apply writes tiles transformed by symmetry to result, with the positions sorted over tiles of the same size
+func (c *canonicalizer) apply(symmetry boardSymmetry, tiles []Tile, result []Tile) {
+	width, height := c.boardDims.X, c.boardDims.Y
+	for i := range tiles {
+		rect := placedRect{x: tiles[i].X, y: tiles[i].Y, w: tiles[i].W, h: tiles[i].H}
+		if tiles[i].Turned {
+			rect.w, rect.h = rect.h, rect.w
+		}
+		if symmetry.transpose {
+			rect = placedRect{x: rect.y, y: rect.x, w: rect.h, h: rect.w}
+		}
+		if symmetry.mirrorX {
+			rect.x = width - rect.x - rect.w
+		}
+		if symmetry.mirrorY {
+			rect.y = height - rect.y - rect.h
+		}
+		c.rects[i] = rect
+	}
+	for _, group := range c.sameSize {
+		rects := c.sorted[:0]
+		for _, i := range group {
+			rects = append(rects, c.rects[i])
+		}
+		//insertion sort, most groups have one or two tiles
+		for n := 1; n < len(rects); n++ {
+			for m := n; m > 0 && lessRect(rects[m], rects[m-1]); m-- {
+				rects[m], rects[m-1] = rects[m-1], rects[m]
+			}
+		}
+		for n, i := range group {
+			result[i] = tiles[i]
+			result[i].Place(core.Coord{X: rects[n].x, Y: rects[n].y}, rects[n].w != tiles[i].W)
+		}
+	}
+}
+
+//lessRect orders rectangles by X and then Y
+func lessRect(a, b placedRect) bool {
+	return a.x < b.x || a.x == b.x && a.y < b.y
+}
+
+//lessSolution compares the positions of the tiles in order, X first
+func lessSolution(a, b []Tile) bool {
+	for i := range a {
+		if a[i].X != b[i].X {
+			return a[i].X < b[i].X
+		}
+		if a[i].Y != b[i].Y {
+			return a[i].Y < b[i].Y
+		}
+	}
+	return false
+}
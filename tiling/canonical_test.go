@@ -0,0 +1,164 @@
+package tiling
+
+import (
+	"context"
+	"encoding/json"
+	"localhost/flobrm/tilingsolver/core"
+	"sort"
+	"testing"
+)
+
+//testPuzzle is a puzzle with a name for the test output
+type testPuzzle struct {
+	name   string
+	puzzle core.Puzzle
+}
+
+//rotationPuzzles have tiles with a fixed rotation, of both the same size and a different orientation
+var rotationPuzzles = []testPuzzle{
+	{"flat and upright tiles of the same size", core.Puzzle{
+		Board: core.Coord{X: 12, Y: 7},
+		Tiles: []core.Coord{{X: 7, Y: 3}, {X: 1, Y: 8}, {X: 1, Y: 7}, {X: 1, Y: 4}, {X: 4, Y: 1}, {X: 4, Y: 7},
+			{X: 1, Y: 8}, {X: 1, Y: 4}},
+		Rotations: []core.Rotation{core.RotationFree, core.RotationFree, core.RotationFree, core.RotationFlat,
+			core.RotationFlat, core.RotationUpright, core.RotationUpright, core.RotationFree},
+	}},
+	{"flat tiles on a flipped board", core.Puzzle{
+		Board: core.Coord{X: 11, Y: 12},
+		Tiles: []core.Coord{{X: 4, Y: 4}, {X: 2, Y: 12}, {X: 3, Y: 2}, {X: 4, Y: 8}, {X: 2, Y: 12}, {X: 3, Y: 10}},
+		Rotations: []core.Rotation{core.RotationFree, core.RotationFree, core.RotationFree, core.RotationFree,
+			core.RotationFlat, core.RotationFlat},
+	}},
+	{"upright tiles", core.Puzzle{
+		Board: core.Coord{X: 6, Y: 10},
+		Tiles: []core.Coord{{X: 1, Y: 1}, {X: 10, Y: 5}, {X: 1, Y: 2}, {X: 1, Y: 1}, {X: 4, Y: 1}, {X: 1, Y: 1},
+			{X: 1, Y: 1}},
+		Rotations: []core.Rotation{core.RotationFree, core.RotationFree, core.RotationFree, core.RotationUpright,
+			core.RotationUpright, core.RotationUpright, core.RotationFree},
+	}},
+}
+
+//solveAll returns the json of every solution solver finds for puzzle, sorted
+func solveAll(t *testing.T, solver Solver, puzzle core.Puzzle, opts Options) []string {
+	t.Helper()
+	var solutions []string
+	result, err := solver.Solve(context.Background(), puzzle, opts, func(solution []Tile) error {
+		solutions = append(solutions, TileSliceToJSON(solution))
+		return nil
+	}, Progress{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Solutions != len(solutions) {
+		t.Fatalf("result has %d solutions, the sink got %d", result.Solutions, len(solutions))
+	}
+	sort.Strings(solutions)
+	return solutions
+}
+
+//solutionTiles decodes a solution of puzzle, with the rotations of its tiles
+func solutionTiles(t *testing.T, puzzle core.Puzzle, solution string) []Tile {
+	t.Helper()
+	var tiles []Tile
+	if err := json.Unmarshal([]byte(solution), &tiles); err != nil {
+		t.Fatal(err)
+	}
+	searchTiles := searchTiles(puzzle, false)
+	for i := range tiles {
+		tiles[i].Rotation = searchTiles[i].Rotation
+	}
+	return tiles
+}
+
+func TestSolutionsRespectRotations(t *testing.T) {
+	noSSN := DefaultOptions()
+	noSSN.FullSSNCheck = false
+	for _, test := range rotationPuzzles {
+		for _, opts := range []Options{DefaultOptions(), noSSN} {
+			found := 0
+			_, err := NaiveSolver{}.Solve(context.Background(), test.puzzle, opts, func(solution []Tile) error {
+				found++
+				for _, violation := range VerifyPuzzleSolution(test.puzzle, solution) {
+					t.Errorf("%s, %s: %v in %s", test.name, opts, violation, TileSliceToJSON(solution))
+				}
+				return nil
+			}, Progress{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found == 0 && !opts.FullSSNCheck {
+				t.Errorf("%s: no solutions found", test.name)
+			}
+		}
+	}
+}
+
+func TestCanonicalSolutionIsAVersionOfTheSolution(t *testing.T) {
+	test := rotationPuzzles[0]
+	opts := DefaultOptions()
+	opts.FullSSNCheck = false
+	for _, solution := range solveAll(t, NaiveSolver{}, test.puzzle, opts) {
+		tiles := solutionTiles(t, test.puzzle, solution)
+		if canonical := TileSliceToJSON(CanonicalSolution(test.puzzle.Board, tiles)); canonical != solution {
+			t.Errorf("canonical form of canonical solution %s is %s", solution, canonical)
+		}
+	}
+}
+
+//mirroredSolution returns tiles mirrored along the width and/or the height of a board of boardDims, and with the
+//positions of the first two tiles of the same size and rotation swapped
+func mirroredSolution(boardDims core.Coord, tiles []Tile, mirrorX, mirrorY bool) []Tile {
+	mirrored := make([]Tile, len(tiles))
+	copy(mirrored, tiles)
+	for i := range mirrored {
+		tile := &mirrored[i]
+		w, h := tile.W, tile.H
+		if tile.Turned {
+			w, h = h, w
+		}
+		if mirrorX {
+			tile.X = boardDims.X - tile.X - w
+		}
+		if mirrorY {
+			tile.Y = boardDims.Y - tile.Y - h
+		}
+	}
+	for i := range mirrored {
+		for j := i + 1; j < len(mirrored); j++ {
+			a, b := &mirrored[i], &mirrored[j]
+			if a.W == b.W && a.H == b.H && a.Rotation == b.Rotation {
+				a.X, a.Y, a.Turned, b.X, b.Y, b.Turned = b.X, b.Y, b.Turned, a.X, a.Y, a.Turned
+				return mirrored
+			}
+		}
+	}
+	return mirrored
+}
+
+func TestCanonicalSolutionFiltersVersions(t *testing.T) {
+	for _, test := range testPuzzles() {
+		opts := DefaultOptions()
+		opts.FullSSNCheck = false
+		for _, solution := range solveAll(t, NaiveSolver{}, test.puzzle, opts) {
+			tiles := solutionTiles(t, test.puzzle, solution)
+			for _, countOnly := range []bool{false, true} {
+				seen := newSolutionSet(countOnly)
+				seen.add(tiles)
+				for _, mirror := range [][2]bool{{false, false}, {true, false}, {false, true}, {true, true}} {
+					version := mirroredSolution(test.puzzle.Board, tiles, mirror[0], mirror[1])
+					if len(VerifyPuzzleSolution(test.puzzle, version)) > 0 {
+						t.Fatalf("%s: %s isn't a solution", test.name, TileSliceToJSON(version))
+					}
+					canonical := CanonicalSolution(test.puzzle.Board, version)
+					if json := TileSliceToJSON(canonical); json != solution {
+						t.Errorf("%s: canonical form of %s is %s, expected %s", test.name, TileSliceToJSON(version),
+							json, solution)
+					}
+					if seen.add(canonical) {
+						t.Errorf("%s: %s isn't filtered as a version of %s", test.name, TileSliceToJSON(version), solution)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package tiling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"localhost/flobrm/tilingsolver/core"
+	"math"
+	"math/rand"
+)
+
+//Estimate is the predicted size of a search tree, see EstimateSearch
+type Estimate struct {
+	Probes      int     //number of random probes the estimate is based on
+	TilesPlaced float64 //estimated number of tiles the search places, the mean of all probes
+	StdErr      float64 //standard error of TilesPlaced
+	Low, High   float64 //95% confidence interval of TilesPlaced
+	Depth       float64 //average depth the probes reached
+}
+
+//z95 is the number of standard errors on either side of the mean in a 95% confidence interval
+const z95 = 1.96
+
+//EstimateSearch predicts how many tiles the naive search places in puzzle with opts, between puzzle.Start and
+//puzzle.End, without searching it. Every probe walks from the root to a leaf of the search tree, choosing a random
+//child at every node, and multiplies the number of children on its way (Knuth's estimator). The mean of the probes is
+//an unbiased estimate, but the spread between probes is large for irregular trees, so the confidence interval is only
+//meaningful with enough probes. StopOnSolution is ignored.
+//If ctx is done before all probes are taken, the estimate of the probes so far is returned with the error of ctx.
+func EstimateSearch(ctx context.Context, puzzle core.Puzzle, opts Options, probes int, rng *rand.Rand) (Estimate, error) {
+	if probes <= 0 {
+		return Estimate{}, fmt.Errorf("invalid number of probes %d", probes)
+	}
+	e, err := newEstimator(puzzle, opts, rng)
+	if err != nil {
+		return Estimate{}, err
+	}
+	var sum, sumSquares, depths float64
+	estimate := Estimate{}
+	for estimate.Probes < probes {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		cost, depth := e.probe()
+		sum += cost
+		sumSquares += cost * cost
+		depths += float64(depth)
+		estimate.Probes++
+	}
+	if estimate.Probes == 0 {
+		return estimate, err
+	}
+	n := float64(estimate.Probes)
+	estimate.TilesPlaced = sum / n
+	estimate.Depth = depths / n
+	if estimate.Probes > 1 {
+		variance := (sumSquares - sum*sum/n) / (n - 1)
+		estimate.StdErr = math.Sqrt(math.Max(variance, 0) / n)
+	}
+	estimate.Low = math.Max(estimate.TilesPlaced-z95*estimate.StdErr, 0)
+	estimate.High = estimate.TilesPlaced + z95*estimate.StdErr
+	return estimate, err
+}
+
+//estimator takes random probes of the search tree of one puzzle, it is set up like solveNaive
+type estimator struct {
+	opts               Options
+	rng                *rand.Rand
+	board              Board
+	tiles              []Tile
+	start, stop        []core.TilePlacement //the range of the search on the board as the search sees it, possibly flipped
+	skipLastStartTiles bool
+	children           []core.TilePlacement
+	path               []core.TilePlacement
+}
+
+func newEstimator(puzzle core.Puzzle, opts Options, rng *rand.Rand) (*estimator, error) {
+	if len(puzzle.Rotations) != 0 && len(puzzle.Rotations) != len(puzzle.Tiles) {
+		return nil, fmt.Errorf("puzzle has %d rotations for %d tiles", len(puzzle.Rotations), len(puzzle.Tiles))
+	}
+	if len(puzzle.Tiles) == 0 {
+		return nil, errors.New("puzzle has no tiles")
+	}
+	puzzle = newTileOrder(puzzle, opts.TileOrder).searchPuzzle(puzzle)
+	boardDims := puzzle.Board
+	start, stop := puzzle.Start, puzzle.End
+	boardFlipped := opts.ForceFrameUpright && boardDims.X > boardDims.Y
+	if boardFlipped {
+		boardDims = core.Coord{X: boardDims.Y, Y: boardDims.X}
+		start = flipPlacements(start)
+		stop = flipPlacements(stop)
+	}
+	tiles := searchTiles(puzzle, boardFlipped)
+	board, err := NewBoard(boardDims, tiles, opts.PlacementOrder, opts.Occupancy)
+	if err != nil {
+		return nil, err
+	}
+	return &estimator{
+		opts:               opts,
+		rng:                rng,
+		board:              board,
+		tiles:              tiles,
+		start:              start,
+		stop:               stop,
+		skipLastStartTiles: cornersDistinct(boardDims, puzzle.Tiles),
+	}, nil
+}
+
+//probe walks down a random branch of the search tree and returns the number of tiles the search would place in the
+//whole tree if every node at each depth had as many children as the nodes of this branch, and the depth it reached
+func (e *estimator) probe() (float64, int) {
+	weight, cost := 1.0, 0.0
+	for {
+		placed := e.expand()
+		cost += weight * float64(placed)
+		if len(e.children) == 0 {
+			break
+		}
+		weight *= float64(len(e.children))
+		child := e.children[e.rng.Intn(len(e.children))]
+		//removing a tile doesn't always restore the candidates in the same order, so in rare cases the child doesn't
+		//fit anymore after its siblings were tried, like it wouldn't in the search after backtracking
+		if !e.board.Place(&e.tiles[child.Idx], child.Rot, e.opts.FullSSNCheck) {
+			break
+		}
+		e.path = append(e.path, child)
+	}
+	depth := len(e.path)
+	for ; len(e.path) > 0; e.path = e.path[:len(e.path)-1] {
+		e.board.RemoveLastTile()
+		e.tiles[e.path[len(e.path)-1].Idx].Remove()
+	}
+	return cost, depth
+}
+
+//expand tries every placement the search tries at the current node, it collects the ones the search continues with
+//in e.children and returns the number of tiles placed, which includes the ones rejected by the gap checks
+func (e *estimator) expand() int {
+	e.children = e.children[:0]
+	placed := 0
+	for i := range e.tiles {
+		tile := &e.tiles[i]
+		if tile.Placed {
+			continue
+		}
+		if len(e.path) == 0 && e.skipLastStartTiles && i > len(e.tiles)-4 {
+			break
+		}
+		//the search skips the second of two equal tiles that aren't placed
+		if i > 0 && !e.tiles[i-1].Placed && e.tiles[i-1].W == tile.W && e.tiles[i-1].H == tile.H &&
+			e.tiles[i-1].Rotation == tile.Rotation {
+			continue
+		}
+		for _, turned := range []bool{false, true} {
+			if turned && tile.W == tile.H || !tile.Rotation.Allows(turned) {
+				continue
+			}
+			placement := core.TilePlacement{Idx: i, Rot: turned}
+			if !e.inRange(placement) || !e.board.Place(tile, turned, e.opts.FullSSNCheck) {
+				continue
+			}
+			placed++
+			if !e.opts.GapDetection || !e.board.HasUnfillableGaps(e.opts.NextGapCheck, e.opts.AllDownGapCheck,
+				e.opts.LeftSideGapCheck, e.opts.TotalGapAreaCheck) {
+				e.children = append(e.children, placement)
+			}
+			e.board.RemoveLastTile()
+			tile.Remove()
+		}
+	}
+	return placed
+}
+
+//inRange returns whether the search visits anything below the current path followed by next, between start and stop
+func (e *estimator) inRange(next core.TilePlacement) bool {
+	path := append(e.path, next)
+	if n := Min(len(path), len(e.start)); comparePlacements(path[:n], e.start[:n], false) < 0 {
+		return false
+	}
+	if e.stop == nil {
+		return true
+	}
+	n := Min(len(path), len(e.stop))
+	order := comparePlacements(path[:n], e.stop[:n], false)
+	return order < 0 || order == 0 && len(path) < len(e.stop) //the search stops when it reaches stop
+}
@@ -1,22 +1,13 @@
 package tiling
 
 import (
+	"context"
+	"fmt"
 	"localhost/flobrm/tilingsolver/core"
+	"sync/atomic"
 	"time"
 )
 
-//These constants show which optimizations are available for the current solver
-const (
-	FullSSNCheck        = iota
-	OneLevelSSN         = iota
-	DoGapdetection      = iota
-	OneGapDetection     = iota
-	AllDownGapDetection = iota
-	LeftGapDetection    = iota
-	TotalGapAreaCheck   = iota
-	ForceFrameUpright   = iota
-)
-
 //Debug locations
 var imgPath = "C:/Users/Florian/go/src/localhost/flobrm/tilingsolver/img/"
 
@@ -26,41 +17,109 @@ var imgPath = "C:/Users/Florian/go/src/localhost/flobrm/tilingsolver/img/"
 // returns a map with solutions, the reason for stopping, the number of steps taken,
 // and the tiles as placed on the board at the last step
 func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePlacement,
-	stop []core.TilePlacement, endTime time.Time, stopOnSolution bool, optimizations map[int]bool, placementOrder int) (
-	map[string]int, string, uint, []core.TilePlacement) {
+	stop []core.TilePlacement, endTime time.Time, opts Options) (map[string]int, string, uint, []core.TilePlacement) {
+	ctx, cancel := context.WithDeadline(context.Background(), endTime)
+	defer cancel()
+	return SolveNaiveContext(ctx, boardDims, tileDims, start, stop, opts)
+}
+
+// SolveNaiveContext is SolveNaive, but it stops when ctx is done instead of at a fixed end time.
+// A cancelled or expired context returns status "interrupted" with the current placements,
+// so the job can be resumed later by using them as start.
+func SolveNaiveContext(ctx context.Context, boardDims core.Coord, tileDims []core.Coord, start []core.TilePlacement,
+	stop []core.TilePlacement, opts Options) (map[string]int, string, uint, []core.TilePlacement) {
+	solutions := make(map[string]int)
+	status, tilesPlaced, placements, _ := SolveNaiveStream(ctx, boardDims, tileDims, start, stop, opts,
+		func(solution []Tile) error {
+			solutions[TileSliceToJSON(solution)] = 1
+			return nil
+		})
+	return solutions, status, tilesPlaced, placements
+}
+
+//SolutionSink receives each new canonical solution as soon as it is found, the sink may keep the slice,
+//except with Options.CountOnly where the slice is reused for the next solution.
+//Returning an error interrupts the solver.
+type SolutionSink func(solution []Tile) error
+
+//ChannelSink returns a SolutionSink that sends every solution on ch
+func ChannelSink(ch chan<- []Tile) SolutionSink {
+	return func(solution []Tile) error {
+		ch <- solution
+		return nil
+	}
+}
+
+// SolveNaiveStream is SolveNaiveContext, but instead of collecting solutions it hands every new canonical solution
+// to sink. Only a hash of each solution is kept to filter duplicates.
+// If sink returns an error the solver stops with status "interrupted" and returns that error.
+func SolveNaiveStream(ctx context.Context, boardDims core.Coord, tileDims []core.Coord, start []core.TilePlacement,
+	stop []core.TilePlacement, opts Options, sink SolutionSink) (string, uint, []core.TilePlacement, error) {
+	puzzle := core.Puzzle{Board: boardDims, Tiles: tileDims, Start: start, End: stop}
+	return solveNaive(ctx, puzzle, opts, sink, searchHooks{})
+}
+
+//searchHooks let other functions reuse the search of SolveNaiveStream
+type searchHooks struct {
+	prefixDepth    int                                     //if > 0 never place more than prefixDepth tiles
+	onPrefix       func(prefix []core.TilePlacement) error //called for each newly placed prefix of prefixDepth tiles
+	donateRequests *int32                                  //if set and > 0 the search gives away the end of its range
+	onDonate       func(start, stop []core.TilePlacement)  //receives the range [start, stop) the search won't visit anymore
+	progress       Progress                                //reports the current state while searching
+	stats          *SearchStats                            //if set, the search adds its statistics to it
+}
+
+func solveNaive(ctx context.Context, puzzle core.Puzzle, opts Options, sink SolutionSink,
+	hooks searchHooks) (string, uint, []core.TilePlacement, error) {
+	done := ctx.Done()
+	if len(puzzle.Rotations) != 0 && len(puzzle.Rotations) != len(puzzle.Tiles) {
+		return "interrupted", 0, puzzle.Start, fmt.Errorf("puzzle has %d rotations for %d tiles", len(puzzle.Rotations), len(puzzle.Tiles))
+	}
+	if len(puzzle.Tiles) == 0 {
+		return "interrupted", 0, puzzle.Start, fmt.Errorf("puzzle has no tiles")
+	}
+	//the search works on normalized and sorted tiles, everything it hands out is mapped back to the tiles of puzzle
+	order := newTileOrder(puzzle, opts.TileOrder)
+	search := order.searchPuzzle(puzzle)
+	boardDims := search.Board
+	tileDims := search.Tiles
+	start := search.Start
+	stop := search.End
 
-	checkGaps := optimizations[DoGapdetection]
-	checkFullSSN := optimizations[FullSSNCheck]
-	checkLeftSideGaps := optimizations[LeftGapDetection]
-	checkOnlyNextCandidate := !optimizations[AllDownGapDetection]
-	checkTotalGapArea := optimizations[TotalGapAreaCheck]
-	setUprightBoard := optimizations[ForceFrameUpright]
+	checkGaps := opts.GapDetection
+	checkFullSSN := opts.FullSSNCheck
+	checkNextGap := opts.NextGapCheck
+	checkAllGaps := opts.AllDownGapCheck
+	checkLeftSideGaps := opts.LeftSideGapCheck
+	checkTotalGapArea := opts.TotalGapAreaCheck
+	setUprightBoard := opts.ForceFrameUpright
+	stopOnSolution := opts.StopOnSolution
 	boardFlipped := false
+	solutionDims := boardDims //solutions are returned on the board as the caller passed it
 
-	tiles := make([]Tile, len(tileDims))
 	if setUprightBoard && boardDims.X > boardDims.Y {
 		boardFlipped = true
 		tempX := boardDims.X
 		boardDims.X = boardDims.Y
 		boardDims.Y = tempX
-		for i := range start {
-			start[i].Rot = !start[i].Rot
-		}
-		for i := range stop {
-			stop[i].Rot = !stop[i].Rot
-		}
+		start = flipPlacements(start)
+		stop = flipPlacements(stop)
 	}
-	for i := range tileDims {
-		tiles[i] = NewTile(tileDims[i].X, tileDims[i].Y)
-		tiles[i].Index = i
+	tiles := searchTiles(search, boardFlipped)
+	board, err := NewBoard(boardDims, tiles, opts.PlacementOrder, opts.Occupancy)
+	if err != nil {
+		return "interrupted", 0, puzzle.Start, err
 	}
-	board := NewBoard(boardDims, tiles, placementOrder)
 	// solutions := make([][]Tile, 0) //random starting value
-	solutions := make(map[string]int)
+	solutionHashes := newSolutionSet(opts.CountOnly)
+	var solutionBuffer []Tile //in count only mode solutions aren't kept, so the same slice is used for all of them
+	solutionTiles := make([]Tile, len(tiles))
+	puzzleTiles := searchTiles(puzzle, false) //the solution with the tiles of puzzle, in their order
+	canonical := newCanonicalizer(solutionDims, puzzleTiles)
 
 	// Only skip the last 3 start tiles if we have to use a separate tile for each corner
-	// aka only if the largest side of the largest tile is smaller than the smallest side of the board.
-	doSkipLastStartTiles := boardDims.Y > tileDims[0].X
+	// aka only if no tile can reach from one corner of the board to the next.
+	doSkipLastStartTiles := cornersDistinct(boardDims, tileDims)
 
 	placedTileIndex := make([]int, len(tileDims))[:0] //keeps track of which tiles are currently placed in which order
 	tilesPlaced := 0
@@ -69,6 +128,8 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 	startRotation := false
 	step := 0
 	totalTilesPlaced := uint(0)
+	justPlaced := false //whether the last round placed a tile, instead of removing one
+	progress := newProgressTracker(hooks.progress)
 
 	// rotatedSolutions := 0
 	// totalSolutions := 0
@@ -76,10 +137,18 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 	//place startTiles
 	if start != nil { //TODO test what if nil, what if no fit, what if index out of bounds?
 		if doSkipLastStartTiles && start[0].Idx > len(tiles)-4 { //check if early exit is possible for this job
-			return solutions, "solved", totalTilesPlaced, nil
+			return "solved", totalTilesPlaced, nil, nil
 		}
 		for _, placement := range start {
-			if board.Place(&tiles[placement.Idx], placement.Rot, checkFullSSN) {
+			placed := tiles[placement.Idx].Rotation.Allows(placement.Rot) &&
+				board.Place(&tiles[placement.Idx], placement.Rot, checkFullSSN)
+			//start tiles get the same checks as the search, so a start that the search would skip is skipped here too
+			if placed && checkGaps && board.HasUnfillableGaps(checkNextGap, checkAllGaps, checkLeftSideGaps, checkTotalGapArea) {
+				board.RemoveLastTile()
+				tiles[placement.Idx].Remove()
+				placed = false
+			}
+			if placed {
 				tilesPlaced++
 				placedTileIndex = append(placedTileIndex, placement.Idx)
 			} else {
@@ -94,6 +163,7 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 			}
 		}
 	}
+	board.stats = hooks.stats //the start tiles aren't part of the search, so they aren't counted
 	//check if stopTiles is legit
 	if stop != nil {
 		for _, placement := range stop {
@@ -113,7 +183,7 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 		// 	fmt.Println("start debugging here")
 		// }
 		// if step == 6000 {
-		// 	return solutions, "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped)
+		// 	return "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), nil
 		// }
 		//check for stop conditions
 		if stop != nil {
@@ -131,13 +201,29 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 						// fmt.Println(placedTileIndex)
 						// SaveBoardPic(board, fmt.Sprintf("%sdebugPic%010d.png", imgPath, step), 5)
 						// fmt.Println("past stopper")
-						return solutions, "solved", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped)
+						return "solved", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), nil
 					}
 				}
 			}
 		}
-		if time.Now().After(endTime) {
-			return solutions, "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped)
+		select {
+		case <-done:
+			return "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), nil
+		default:
+		}
+		if hooks.donateRequests != nil && atomic.LoadInt32(hooks.donateRequests) > 0 {
+			if sibling := nextSibling(placedTileIndex, tiles, stop, doSkipLastStartTiles); sibling != nil {
+				donatedStart, donatedStop := sibling, stop
+				if boardFlipped {
+					donatedStart, donatedStop = flipPlacements(sibling), flipPlacements(stop)
+				}
+				hooks.onDonate(order.puzzlePlacements(donatedStart), order.puzzlePlacements(donatedStop))
+				stop = sibling
+			}
+		}
+		if progress.due(totalTilesPlaced) {
+			hooks.progress.Report(getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), totalTilesPlaced)
+			progress.reset(totalTilesPlaced)
 		}
 
 		if tilesPlaced == numTiles {
@@ -145,25 +231,32 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 			// 	fmt.Println("stop to check stuff")
 			// }
 			// SaveBoardPic(board, fmt.Sprintf("%s%010dFirstSolution.png", imgPath, step), 5)
-			newSolution := make([]Tile, numTiles)
-			copy(newSolution, tiles)
-			board.GetCanonicalSolution(&newSolution)
-			if boardFlipped {
-				rotateTiles(&newSolution)
+			newSolution := solutionBuffer
+			if newSolution == nil {
+				newSolution = make([]Tile, numTiles)
+				if opts.CountOnly {
+					solutionBuffer = newSolution
+				}
 			}
-			preLength := len(solutions)
-			solutions[TileSliceToJSON(newSolution)] = 1
-			if stopOnSolution {
-				return solutions, "solved1", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped)
+			copy(solutionTiles, tiles)
+			if boardFlipped {
+				rotateTiles(&solutionTiles)
 			}
-
-			if len(solutions) != preLength {
+			order.puzzleTiles(solutionTiles, puzzleTiles)
+			canonical.canonicalize(puzzleTiles, newSolution)
+			if solutionHashes.add(newSolution) {
+				if err := sink(newSolution); err != nil {
+					return "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), err
+				}
 				// fmt.Println("solution found:")
 				// fmt.Println(placedTileIndex)
 				// fmt.Println(tiles)
 				// SaveBoardPic(board, fmt.Sprintf("%s%010d_Solution.png", imgPath, step), 5)
 				// SavePicFromPuzzle(board.Size, newSolution, fmt.Sprintf("%s%010d_RotatedSolution.png", imgPath, step), 5)
 			}
+			if stopOnSolution {
+				return "solved1", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), nil
+			}
 			// solutions = append(solutions, newSolution)
 			// fmt.Println("solution found")
 		}
@@ -172,23 +265,36 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 		// fmt.Print("starting new round\n\n")
 		// fmt.Println(board)
 
+		if hooks.prefixDepth > 0 && tilesPlaced >= hooks.prefixDepth {
+			if justPlaced && tilesPlaced == hooks.prefixDepth {
+				if err := hooks.onPrefix(getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order)); err != nil {
+					return "interrupted", totalTilesPlaced, getCurrentPlacements(placedTileIndex, tiles, boardFlipped, order), err
+				}
+			}
+			startIndex = len(tiles) //don't go deeper, this makes sure the last tile is removed next
+		}
+
 		placedThisRound := false //Is this still necessary? we break after placing a tile
 		for i := startIndex; i < len(tiles); i++ {
 			if !tiles[i].Placed {
 				// handle double tiles
-				if i > 0 && !tiles[i-1].Placed && tiles[i-1].W == tiles[i].W && tiles[i-1].H == tiles[i].H {
+				if i > 0 && !tiles[i-1].Placed && tiles[i-1].W == tiles[i].W && tiles[i-1].H == tiles[i].H &&
+					tiles[i-1].Rotation == tiles[i].Rotation {
 					startRotation = false
 					continue
 				}
 				// fmt.Println("trying to fit tile", tiles[i])
-				if !startRotation && board.Place(&tiles[i], false, checkFullSSN) { //place normal
+				if !startRotation && tiles[i].Rotation.Allows(false) && board.Place(&tiles[i], false, checkFullSSN) { //place normal
 					// fmt.Println("fitting tile normal", tiles[i])
 					// fmt.Println("placed tile normal", board)
-					if checkGaps && board.HasUnfillableGaps(checkOnlyNextCandidate, checkLeftSideGaps, checkTotalGapArea) {
+					if checkGaps && board.HasUnfillableGaps(checkNextGap, checkAllGaps, checkLeftSideGaps, checkTotalGapArea) {
 						// SaveBoardPic(board, fmt.Sprintf("%sdebugPic%010d_s%2d.png", imgPath, step, i), 5)
 						board.RemoveLastTile()
 						tiles[i].Remove()
 						totalTilesPlaced++
+						if hooks.stats != nil {
+							hooks.stats.addNode(tilesPlaced)
+						}
 					} else {
 						startIndex = 0
 						startRotation = false
@@ -196,18 +302,24 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 						placedTileIndex = append(placedTileIndex, i)
 						tilesPlaced++
 						totalTilesPlaced++
+						if hooks.stats != nil {
+							hooks.stats.addNode(tilesPlaced - 1)
+						}
 						break
 					}
 				}
 				// fmt.Println("trying to fit tile turned", tiles[i])
-				if tiles[i].W != tiles[i].H && board.Place(&tiles[i], true, checkFullSSN) { // place turned, if tile is not square
+				if tiles[i].W != tiles[i].H && tiles[i].Rotation.Allows(true) && board.Place(&tiles[i], true, checkFullSSN) { // place turned, if tile is not square
 					// fmt.Println("fitting tile turned", tiles[i])
 					// fmt.Println("placed tile turned", board)
-					if checkGaps && board.HasUnfillableGaps(checkOnlyNextCandidate, checkLeftSideGaps, checkTotalGapArea) {
+					if checkGaps && board.HasUnfillableGaps(checkNextGap, checkAllGaps, checkLeftSideGaps, checkTotalGapArea) {
 						// SaveBoardPic(board, fmt.Sprintf("%sdebugPic%010d_t%2d.png", imgPath, step, i), 5)
 						board.RemoveLastTile()
 						tiles[i].Remove()
 						totalTilesPlaced++
+						if hooks.stats != nil {
+							hooks.stats.addNode(tilesPlaced)
+						}
 					} else {
 						startIndex = 0
 						startRotation = false
@@ -215,22 +327,29 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 						placedTileIndex = append(placedTileIndex, i)
 						tilesPlaced++
 						totalTilesPlaced++
+						if hooks.stats != nil {
+							hooks.stats.addNode(tilesPlaced - 1)
+						}
 						break
 					}
 				}
 				startRotation = false
 			}
 		}
+		justPlaced = placedThisRound
 		if !placedThisRound {
 			if tilesPlaced == 0 { //No tiles on board and impossible to place new tiles, so exit
 				// fmt.Println("rotated solutions:", rotatedSolutions)
 				// fmt.Println("total solutions:", totalSolutions)
-				return solutions, "solved", totalTilesPlaced, nil
+				return "solved", totalTilesPlaced, nil, nil
 			}
 
 			//Remove the last tile and keep track of which tile to try next
 			// fmt.Println("REMOVING tile", tiles[placedTileIndex[len(placedTileIndex)-1]])
 			tilesPlaced--
+			if hooks.stats != nil {
+				hooks.stats.Backtracks++
+			}
 			board.RemoveLastTile()
 			tiles[placedTileIndex[len(placedTileIndex)-1]].Remove()
 			// fmt.Println(board)
@@ -246,14 +365,78 @@ func SolveNaive(boardDims core.Coord, tileDims []core.Coord, start []core.TilePl
 			//This only works if all tiles are smaller than both board sides
 			if tilesPlaced == 0 { //Skip the last 3 startingtiles, solutions with those already exist
 				if doSkipLastStartTiles && startIndex > len(tiles)-4 {
-					return solutions, "solved", totalTilesPlaced, nil
+					return "solved", totalTilesPlaced, nil, nil
+				}
+			}
+		}
+	}
+}
+
+//searchTiles creates the tiles of puzzle for the search, with their rotation policy turned along if the board is flipped
+func searchTiles(puzzle core.Puzzle, boardFlipped bool) []Tile {
+	tiles := make([]Tile, len(puzzle.Tiles))
+	for i, dims := range puzzle.Tiles {
+		tiles[i] = NewTile(dims.X, dims.Y)
+		tiles[i].Index = i
+		if len(puzzle.Rotations) != 0 && dims.X != dims.Y { //square tiles look the same both ways
+			tiles[i].Rotation = puzzle.Rotations[i]
+			if boardFlipped {
+				tiles[i].Rotation = tiles[i].Rotation.Transposed()
+			}
+		}
+	}
+	return tiles
+}
+
+//nextSibling finds the shallowest placement after the current one that the search still has to visit before stop.
+//It returns the placed tiles up to that level followed by the next tile, or nil if there is none.
+//Only the tiles already on the board are taken into account, the next tile doesn't have to fit.
+func nextSibling(placedTileIndex []int, tiles []Tile, stop []core.TilePlacement, skipLastStartTiles bool) []core.TilePlacement {
+	isPlaced := make([]bool, len(tiles))
+	prefix := make([]core.TilePlacement, 0, len(placedTileIndex))
+	for _, idx := range placedTileIndex {
+		next := core.TilePlacement{Idx: idx, Rot: true}
+		if tiles[idx].Turned || tiles[idx].W == tiles[idx].H || !tiles[idx].Rotation.Allows(true) {
+			next.Idx = len(tiles)
+			for i := idx + 1; i < len(tiles); i++ {
+				if len(prefix) == 0 && skipLastStartTiles && i > len(tiles)-4 {
+					break
+				}
+				// same rules as the search, used tiles and the second of two equal unused tiles are skipped
+				if isPlaced[i] || !isPlaced[i-1] && tiles[i-1].W == tiles[i].W && tiles[i-1].H == tiles[i].H &&
+					tiles[i-1].Rotation == tiles[i].Rotation {
+					continue
 				}
+				next = core.TilePlacement{Idx: i, Rot: !tiles[i].Rotation.Allows(false)}
+				break
+			}
+		}
+		if next.Idx < len(tiles) {
+			sibling := append(append([]core.TilePlacement(nil), prefix...), next)
+			if stop == nil || comparePlacements(sibling, stop, false) < 0 {
+				return sibling
 			}
 		}
+		prefix = append(prefix, core.TilePlacement{Idx: idx, Rot: tiles[idx].Turned})
+		isPlaced[idx] = true
 	}
+	return nil
 }
 
-func getCurrentPlacements(tileIndexes []int, tiles []Tile, boardFlipped bool) []core.TilePlacement {
+//flipPlacements returns a copy of placements with every rotation inverted, for boards the solver flipped upright
+func flipPlacements(placements []core.TilePlacement) []core.TilePlacement {
+	if placements == nil {
+		return nil
+	}
+	flipped := make([]core.TilePlacement, len(placements))
+	for i, placement := range placements {
+		flipped[i] = core.TilePlacement{Idx: placement.Idx, Rot: !placement.Rot}
+	}
+	return flipped
+}
+
+//getCurrentPlacements returns the placements of the tiles on the board, as tiles of the puzzle on its unflipped board
+func getCurrentPlacements(tileIndexes []int, tiles []Tile, boardFlipped bool, order tileOrder) []core.TilePlacement {
 	placements := make([]core.TilePlacement, len(tileIndexes))[:0]
 	for _, idx := range tileIndexes {
 		if boardFlipped {
@@ -262,7 +445,7 @@ func getCurrentPlacements(tileIndexes []int, tiles []Tile, boardFlipped bool) []
 			placements = append(placements, core.TilePlacement{Idx: idx, Rot: tiles[idx].Turned})
 		}
 	}
-	return placements
+	return order.puzzlePlacements(placements)
 }
 
 func rotateTiles(tiles *[]Tile) {
@@ -277,3 +460,14 @@ func rotateTiles(tiles *[]Tile) {
 		(*tiles)[i].CurH = tempCurW
 	}
 }
+
+//cornersDistinct returns whether every solution has four different tiles in its corners. That is the case if no tile
+//has a side as long as a side of the board, because only such a tile can reach from one corner to the next.
+func cornersDistinct(boardDims core.Coord, tiles []core.Coord) bool {
+	for _, tile := range tiles {
+		if tile.X == boardDims.X || tile.X == boardDims.Y || tile.Y == boardDims.X || tile.Y == boardDims.Y {
+			return false
+		}
+	}
+	return true
+}
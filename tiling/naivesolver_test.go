@@ -0,0 +1,35 @@
+package tiling
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+	"testing"
+)
+
+//TestSolverStartsWithTilesThatReachTwoCorners checks puzzles where a tile has a side as long as a side of the board.
+//The search used to skip the last start tiles when the first tile is shorter than the height of the board, and in the
+//input order only found 3 of the 6 and 20 of the 32 solutions.
+func TestSolverStartsWithTilesThatReachTwoCorners(t *testing.T) {
+	tests := []struct {
+		testPuzzle
+		solutions int
+	}{
+		{testPuzzle{"tile of the full board height", core.Puzzle{
+			Board: core.Coord{X: 4, Y: 5},
+			Tiles: []core.Coord{{X: 2, Y: 1}, {X: 2, Y: 3}, {X: 5, Y: 1}, {X: 1, Y: 5}, {X: 2, Y: 1}},
+		}}, 6},
+		{testPuzzle{"tiles of the full board width", core.Puzzle{
+			Board: core.Coord{X: 4, Y: 7},
+			Tiles: []core.Coord{{X: 1, Y: 1}, {X: 1, Y: 3}, {X: 1, Y: 4}, {X: 4, Y: 2}, {X: 4, Y: 3}},
+		}}, 32},
+	}
+	for _, test := range tests {
+		for _, order := range []string{TileOrderInput, TileOrderArea} {
+			opts := DefaultOptions()
+			opts.FullSSNCheck = false
+			opts.TileOrder = order
+			if solutions := solveAll(t, NaiveSolver{}, test.puzzle, opts); len(solutions) != test.solutions {
+				t.Errorf("%s, %s: %d solutions, expected %d", test.name, order, len(solutions), test.solutions)
+			}
+		}
+	}
+}
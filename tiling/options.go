@@ -0,0 +1,184 @@
+package tiling
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Options holds the pruning rules and search settings used by the solvers.
+//The zero value turns every optimization off, DefaultOptions returns the recommended settings.
+type Options struct {
+	FullSSNCheck      bool   `json:"full_ssn_check"`       //hierarchical same side neighbor check, default true
+	OneLevelSSNCheck  bool   `json:"1level_ssn_check"`     //one level same side neighbor check, not implemented yet, default false
+	GapDetection      bool   `json:"gap_detection_check"`  //enable gap detection, overrules the more specific gap checks, default true
+	NextGapCheck      bool   `json:"next_gap_check"`       //check the next gap where a tile will be placed, default true
+	AllDownGapCheck   bool   `json:"all_down_gap_check"`   //check all normal gaps, implies NextGapCheck, default true
+	LeftSideGapCheck  bool   `json:"left_side_gaps_check"` //check gaps from the left side to the frame top, default true
+	TotalGapAreaCheck bool   `json:"total_gap_area_check"` //check if the total gap area can be filled, default false
+	ForceFrameUpright bool   `json:"force_frame_upright"`  //rotate the frame so the shortest side is the width, default true
+	PlacementOrder    int    `json:"placement_choice"`     //one of LastGapFirst, SmallestGapFirst or BottomLeft, default SmallestGapFirst
+	StopOnSolution    bool   `json:"stop_on_solution"`     //stop after the first solution, default false
+	CountOnly         bool   `json:"count_only"`           //only count solutions, they aren't handed to the sink, default false
+	CountCorners      bool   `json:"count_corners"`        //count solutions per tile in the bottom left corner, default false
+	Occupancy         string `json:"occupancy"`            //how the board measures gaps, one of the Occupancy constants, default auto
+	SearchStats       bool   `json:"search_stats"`         //collect SearchStats, default false
+	TileOrder         string `json:"tile_order"`           //order the search tries the tiles in, one of the TileOrder constants, default input
+}
+
+//DefaultOptions returns the options the command line uses when no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		FullSSNCheck:      true,
+		OneLevelSSNCheck:  false,
+		GapDetection:      true,
+		NextGapCheck:      true,
+		AllDownGapCheck:   true,
+		LeftSideGapCheck:  true,
+		TotalGapAreaCheck: false, //Turned off because it doesn't work or is never triggered
+		ForceFrameUpright: true,
+		PlacementOrder:    SmallestGapFirst,
+		StopOnSolution:    false,
+		CountOnly:         false,
+		CountCorners:      false,
+		Occupancy:         OccupancyAuto,
+		SearchStats:       false,
+		TileOrder:         TileOrderInput,
+	}
+}
+
+//Validate returns an error if the options contain a setting the solvers can't handle.
+func (o Options) Validate() error {
+	if _, ok := placementOrderName(o.PlacementOrder); !ok {
+		return fmt.Errorf("unknown placement order %d", o.PlacementOrder)
+	}
+	if o.OneLevelSSNCheck {
+		return errors.New("1level_ssn_check is not implemented")
+	}
+	if err := validOccupancy(o.Occupancy); err != nil {
+		return err
+	}
+	if err := validTileOrder(o.TileOrder); err != nil {
+		return err
+	}
+	return nil
+}
+
+//RegisterFlags binds every option to a command line flag in fs, using the current values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.FullSSNCheck, "full_ssn_check", o.FullSSNCheck, "set hierarchical same side neighbor check")
+	fs.BoolVar(&o.OneLevelSSNCheck, "1level_ssn_check", o.OneLevelSSNCheck, "set one level same side neighbor check (not implemented yet)")
+	fs.BoolVar(&o.GapDetection, "gap_detection_check", o.GapDetection, "Enable gap detection, overrules more specific options")
+	fs.BoolVar(&o.NextGapCheck, "next_gap_check", o.NextGapCheck, "check the next gap where a tile will be placed")
+	fs.BoolVar(&o.AllDownGapCheck, "all_down_gap_check", o.AllDownGapCheck, "check all normal gaps")
+	fs.BoolVar(&o.LeftSideGapCheck, "left_side_gaps_check", o.LeftSideGapCheck, "check gaps from the left side to the frame top")
+	fs.BoolVar(&o.TotalGapAreaCheck, "total_gap_area_check", o.TotalGapAreaCheck, "check if the total gap area can be filled")
+	fs.BoolVar(&o.ForceFrameUpright, "force_frame_upright", o.ForceFrameUpright,
+		"Rotate the frame, start, and stop so the shortest frame side is used as the width.")
+	fs.Var((*placementOrderValue)(&o.PlacementOrder), "placement_choice",
+		"The algorithm determining the position of the next tile. [lastGapAdded, smallestGap, bottomLeft]")
+	fs.BoolVar(&o.StopOnSolution, "stop_on_solution", o.StopOnSolution, "Stop the solver after finding the first solution")
+	fs.BoolVar(&o.CountOnly, "count_only", o.CountOnly, "Only count the distinct solutions instead of saving them")
+	fs.BoolVar(&o.CountCorners, "count_corners", o.CountCorners,
+		"Also count the solutions per tile in the bottom left corner of the canonical solution")
+	fs.StringVar(&o.Occupancy, "occupancy", o.Occupancy,
+		"How the board keeps track of occupied cells, the results are the same. [auto, grid, bitboard]")
+	fs.BoolVar(&o.SearchStats, "search_stats", o.SearchStats,
+		"Count the nodes per depth and the placements each pruning rule rejects, they end up in the stats column")
+	fs.StringVar(&o.TileOrder, "tile_order", o.TileOrder,
+		"The order the search tries the tiles in, jobs have to be split and solved with the same order. [input, area, longest_side, perimeter]")
+}
+
+//Args returns the command line flags that recreate o when parsed by a FlagSet set up with RegisterFlags.
+func (o Options) Args() []string {
+	order, _ := placementOrderName(o.PlacementOrder)
+	return []string{
+		"-full_ssn_check=" + strconv.FormatBool(o.FullSSNCheck),
+		"-1level_ssn_check=" + strconv.FormatBool(o.OneLevelSSNCheck),
+		"-gap_detection_check=" + strconv.FormatBool(o.GapDetection),
+		"-next_gap_check=" + strconv.FormatBool(o.NextGapCheck),
+		"-all_down_gap_check=" + strconv.FormatBool(o.AllDownGapCheck),
+		"-left_side_gaps_check=" + strconv.FormatBool(o.LeftSideGapCheck),
+		"-total_gap_area_check=" + strconv.FormatBool(o.TotalGapAreaCheck),
+		"-force_frame_upright=" + strconv.FormatBool(o.ForceFrameUpright),
+		"-placement_choice=" + order,
+		"-stop_on_solution=" + strconv.FormatBool(o.StopOnSolution),
+		"-count_only=" + strconv.FormatBool(o.CountOnly),
+		"-count_corners=" + strconv.FormatBool(o.CountCorners),
+		"-occupancy=" + o.Occupancy,
+		"-search_stats=" + strconv.FormatBool(o.SearchStats),
+		"-tile_order=" + o.TileOrder,
+	}
+}
+
+//String returns the options as command line flags, this is what ends up in the status output
+func (o Options) String() string {
+	return strings.Join(o.Args(), " ")
+}
+
+//MarshalJSON encodes the placement order by name instead of by number
+func (o Options) MarshalJSON() ([]byte, error) {
+	type plainOptions Options
+	order, ok := placementOrderName(o.PlacementOrder)
+	if !ok {
+		return nil, fmt.Errorf("unknown placement order %d", o.PlacementOrder)
+	}
+	return json.Marshal(struct {
+		plainOptions
+		PlacementOrder string `json:"placement_choice"`
+	}{plainOptions(o), order})
+}
+
+//UnmarshalJSON decodes options as written by MarshalJSON. Fields missing from data keep their current value,
+//so unmarshalling into DefaultOptions() only overrides what is specified.
+func (o *Options) UnmarshalJSON(data []byte) error {
+	type plainOptions Options
+	order, _ := placementOrderName(o.PlacementOrder)
+	aux := struct {
+		plainOptions
+		PlacementOrder string `json:"placement_choice"`
+	}{plainOptions(*o), order}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	placementOrder, ok := PlacementOrderOptions[aux.PlacementOrder]
+	if !ok {
+		return fmt.Errorf("unknown placement_choice %q", aux.PlacementOrder)
+	}
+	*o = Options(aux.plainOptions)
+	o.PlacementOrder = placementOrder
+	return nil
+}
+
+//placementOrderName is the reverse lookup of PlacementOrderOptions
+func placementOrderName(order int) (string, bool) {
+	for name, value := range PlacementOrderOptions {
+		if value == order {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+//placementOrderValue lets a placement order be set by name from the command line
+type placementOrderValue int
+
+func (v *placementOrderValue) String() string {
+	if v == nil {
+		return ""
+	}
+	name, _ := placementOrderName(int(*v))
+	return name
+}
+
+func (v *placementOrderValue) Set(name string) error {
+	order, ok := PlacementOrderOptions[name]
+	if !ok {
+		return fmt.Errorf("couldn't recognize placement_choice %q", name)
+	}
+	*v = placementOrderValue(order)
+	return nil
+}
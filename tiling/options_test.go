@@ -0,0 +1,104 @@
+package tiling
+
+import (
+	"encoding/json"
+	"flag"
+	"testing"
+)
+
+//changedOptions has every option set to something else than its default
+func changedOptions() Options {
+	return Options{
+		FullSSNCheck:      false,
+		OneLevelSSNCheck:  true,
+		GapDetection:      false,
+		NextGapCheck:      false,
+		AllDownGapCheck:   false,
+		LeftSideGapCheck:  false,
+		TotalGapAreaCheck: true,
+		ForceFrameUpright: false,
+		PlacementOrder:    BottomLeft,
+		StopOnSolution:    true,
+		CountOnly:         true,
+		CountCorners:      true,
+		Occupancy:         OccupancyBitboard,
+		SearchStats:       true,
+		TileOrder:         TileOrderPerimeter,
+	}
+}
+
+func TestOptionsFlagRoundTrip(t *testing.T) {
+	for _, opts := range []Options{DefaultOptions(), changedOptions()} {
+		parsed := DefaultOptions()
+		if opts == parsed {
+			parsed = changedOptions()
+		}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		parsed.RegisterFlags(fs)
+		if err := fs.Parse(opts.Args()); err != nil {
+			t.Fatal(err)
+		}
+		if parsed != opts {
+			t.Errorf("flags %s are parsed as %s", opts, parsed)
+		}
+	}
+}
+
+func TestOptionsJSONRoundTrip(t *testing.T) {
+	for _, opts := range []Options{DefaultOptions(), changedOptions()} {
+		data, err := json.Marshal(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := DefaultOptions()
+		if opts == decoded {
+			decoded = changedOptions()
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded != opts {
+			t.Errorf("%s is decoded as %s", data, decoded)
+		}
+	}
+
+	//missing fields keep their value
+	decoded := DefaultOptions()
+	if err := json.Unmarshal([]byte(`{"count_only":true,"placement_choice":"bottomLeft"}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultOptions()
+	expected.CountOnly = true
+	expected.PlacementOrder = BottomLeft
+	if decoded != expected {
+		t.Errorf("decoded %s, expected %s", decoded, expected)
+	}
+	if err := json.Unmarshal([]byte(`{"placement_choice":"largestGap"}`), &decoded); err == nil {
+		t.Error("unknown placement_choice is decoded")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(o *Options)
+		valid  bool
+	}{
+		{"default", func(o *Options) {}, true},
+		{"no optimizations", func(o *Options) { *o = Options{PlacementOrder: LastGapFirst} }, true},
+		{"unknown placement order", func(o *Options) { o.PlacementOrder = -1 }, false},
+		{"one level same side neighbor check", func(o *Options) { o.OneLevelSSNCheck = true }, false},
+		{"grid", func(o *Options) { o.Occupancy = OccupancyGrid }, true},
+		{"unknown occupancy", func(o *Options) { o.Occupancy = "skyline" }, false},
+		{"tile order", func(o *Options) { o.TileOrder = TileOrderLongestSide }, true},
+		{"input order", func(o *Options) { o.TileOrder = TileOrderInput }, true},
+		{"unknown tile order", func(o *Options) { o.TileOrder = "width" }, false},
+	}
+	for _, test := range tests {
+		opts := DefaultOptions()
+		test.change(&opts)
+		if err := opts.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: Validate returns %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package tiling
+
+import (
+	"context"
+	"localhost/flobrm/tilingsolver/core"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+//ParallelSolver implements Solver by searching a single puzzle with several workers.
+//Workers that run out of work get the unexplored end of the range of a busy worker, so they share one search tree.
+type ParallelSolver struct {
+	Workers int //number of search workers, 0 uses one per cpu
+}
+
+//Solve searches puzzle with the naive search on p.Workers workers. It finds the same solutions as NaiveSolver,
+//duplicates found by different workers are only handed to sink once, and sink is never called concurrently.
+//If interrupted, CurrentState is the earliest placement any worker didn't finish, so resuming from it can repeat
+//work of other workers but never skips any. Progress reports use the same state, Nodes counts per worker.
+func (p ParallelSolver) Solve(ctx context.Context, puzzle core.Puzzle, opts Options, sink SolutionSink,
+	progress Progress) (Result, error) {
+	if result, infeasible := infeasibleResult(puzzle); infeasible {
+		return result, nil
+	}
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	search := &parallelSearch{
+		ctx:            searchCtx,
+		cancel:         cancel,
+		puzzle:         puzzle,
+		opts:           opts,
+		order:          newTileOrder(puzzle, opts.TileOrder),
+		pending:        []core.Puzzle{puzzle},
+		progress:       progress,
+		positions:      make([][]core.TilePlacement, workers),
+		running:        make([]uint, workers),
+		active:         make([]bool, workers),
+		sink:           sink,
+		solutionHashes: newSolutionSet(opts.CountOnly),
+		counter:        newSolutionCounter(len(puzzle.Tiles), opts.CountCorners),
+	}
+	if opts.SearchStats {
+		search.stats = &SearchStats{}
+	}
+	search.jobAvailable = sync.NewCond(&search.mutex)
+	go func() { //wake up waiting workers when the search is cancelled
+		<-searchCtx.Done()
+		search.mutex.Lock()
+		search.jobAvailable.Broadcast()
+		search.mutex.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			search.work(worker)
+		}(i)
+	}
+	wg.Wait()
+	return search.result()
+}
+
+//parallelSearch is the state shared by the workers of ParallelSolver
+type parallelSearch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	puzzle core.Puzzle
+	opts   Options
+	order  tileOrder //the order of the tiles in the search, to compare states
+
+	mutex          sync.Mutex
+	jobAvailable   *sync.Cond
+	pending        []core.Puzzle          //donated ranges no worker started yet
+	busy           int                    //workers that are searching
+	idle           int                    //workers waiting for a range
+	donateRequests int32                  //1 while there are more idle workers than pending ranges, read by the searching workers
+	tilesPlaced    uint                   //tiles placed in finished ranges
+	stats          *SearchStats           //statistics of finished ranges, with Options.SearchStats
+	unfinished     [][]core.TilePlacement //current state of every interrupted range
+	progress       Progress
+	positions      [][]core.TilePlacement //last reported state of each worker
+	running        []uint                 //tiles placed by each worker in its current range
+	active         []bool                 //whether each worker is searching a range
+	solvedState    []core.TilePlacement   //set when a worker stopped on a solution
+	err            error
+
+	sinkMutex      sync.Mutex
+	sink           SolutionSink
+	solutionHashes solutionSet
+	counter        solutionCounter
+}
+
+//work keeps searching ranges until there are none left
+func (s *parallelSearch) work(worker int) {
+	hooks := searchHooks{donateRequests: &s.donateRequests, onDonate: s.donate}
+	var stats SearchStats
+	if s.opts.SearchStats {
+		hooks.stats = &stats
+	}
+	if s.progress.Report != nil {
+		hooks.progress = Progress{Nodes: s.progress.Nodes, Interval: s.progress.Interval,
+			Report: func(currentState []core.TilePlacement, tilesPlaced uint) {
+				s.reportProgress(worker, currentState, tilesPlaced)
+			}}
+	}
+	for {
+		job, ok := s.nextJob(worker)
+		if !ok {
+			return
+		}
+		status, tilesPlaced, state, err := solveNaive(s.ctx, job, s.opts, s.addSolution, hooks)
+		s.finishJob(worker, status, tilesPlaced, state, err, hooks.stats)
+		stats = SearchStats{}
+	}
+}
+
+//nextJob waits for a pending range, it returns false when all work is done or the search was cancelled
+func (s *parallelSearch) nextJob(worker int) (core.Puzzle, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.idle++
+	s.updateDonateRequests()
+	for len(s.pending) == 0 && s.busy > 0 && s.ctx.Err() == nil {
+		s.jobAvailable.Wait()
+	}
+	s.idle--
+	if len(s.pending) == 0 || s.ctx.Err() != nil {
+		s.updateDonateRequests()
+		return core.Puzzle{}, false
+	}
+	job := s.pending[0]
+	s.pending = s.pending[1:]
+	s.busy++
+	s.active[worker] = true
+	s.positions[worker] = job.Start
+	s.running[worker] = 0
+	s.updateDonateRequests()
+	return job, true
+}
+
+//donate is called by a searching worker that gives away the range [start, stop)
+func (s *parallelSearch) donate(start, stop []core.TilePlacement) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := s.puzzle
+	job.Start = start
+	job.End = stop
+	s.pending = append(s.pending, job)
+	s.updateDonateRequests()
+	s.jobAvailable.Signal()
+}
+
+//finishJob collects the results of a worker after it stopped searching a range
+func (s *parallelSearch) finishJob(worker int, status string, tilesPlaced uint, state []core.TilePlacement, err error,
+	stats *SearchStats) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.busy--
+	s.active[worker] = false
+	s.running[worker] = 0
+	s.tilesPlaced += tilesPlaced
+	if stats != nil {
+		s.stats.Add(stats)
+	}
+	switch {
+	case err != nil:
+		if s.err == nil {
+			s.err = err
+		}
+		s.unfinished = append(s.unfinished, state)
+		s.cancel()
+	case status == "solved1":
+		if s.solvedState == nil {
+			s.solvedState = state
+		}
+		s.cancel()
+	case status == "interrupted":
+		s.unfinished = append(s.unfinished, state)
+	}
+	s.jobAvailable.Broadcast()
+}
+
+//reportProgress combines the state of worker with the other workers into one state to continue from
+func (s *parallelSearch) reportProgress(worker int, currentState []core.TilePlacement, tilesPlaced uint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.positions[worker] = currentState
+	s.running[worker] = tilesPlaced
+	totalTilesPlaced := s.tilesPlaced
+	for _, running := range s.running {
+		totalTilesPlaced += running
+	}
+	s.progress.Report(s.resumePoint(), totalTilesPlaced)
+}
+
+//resumePoint returns the earliest state that some worker, pending range or interrupted range didn't finish,
+//s.mutex must be held
+func (s *parallelSearch) resumePoint() []core.TilePlacement {
+	states := append([][]core.TilePlacement(nil), s.unfinished...)
+	for _, job := range s.pending {
+		states = append(states, job.Start)
+	}
+	for worker, active := range s.active {
+		if active {
+			states = append(states, s.positions[worker])
+		}
+	}
+	if len(states) == 0 {
+		return nil
+	}
+	turnedFirst := s.opts.ForceFrameUpright && s.puzzle.Board.X > s.puzzle.Board.Y
+	earliest := states[0]
+	for _, state := range states[1:] {
+		if s.order.comparePlacements(state, earliest, turnedFirst) < 0 {
+			earliest = state
+		}
+	}
+	return earliest
+}
+
+//updateDonateRequests asks searching workers to donate if there are idle workers without a range, s.mutex must be held
+func (s *parallelSearch) updateDonateRequests() {
+	if s.idle > len(s.pending) {
+		atomic.StoreInt32(&s.donateRequests, 1)
+	} else {
+		atomic.StoreInt32(&s.donateRequests, 0)
+	}
+}
+
+//addSolution is the sink of every worker, it filters solutions other workers already found
+func (s *parallelSearch) addSolution(solution []Tile) error {
+	s.sinkMutex.Lock()
+	defer s.sinkMutex.Unlock()
+	if !s.solutionHashes.add(solution) {
+		return nil
+	}
+	s.counter.add(solution)
+	if s.opts.CountOnly {
+		return nil
+	}
+	return s.sink(solution)
+}
+
+//result combines the results of all workers, after they stopped
+func (s *parallelSearch) result() (Result, error) {
+	result := Result{Status: "solved", TilesPlaced: s.tilesPlaced, Solutions: s.counter.solutions,
+		CornerCounts: s.counter.cornerCounts, Stats: s.stats}
+	if s.solvedState != nil && s.err == nil {
+		result.Status = "solved1"
+		result.CurrentState = s.solvedState
+		return result, nil
+	}
+	if len(s.unfinished) == 0 && len(s.pending) == 0 {
+		return result, s.err
+	}
+	result.Status = "interrupted"
+	result.CurrentState = s.resumePoint()
+	return result, s.err
+}
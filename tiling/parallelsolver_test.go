@@ -0,0 +1,21 @@
+package tiling
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParallelSolverFindsTheSameSolutions(t *testing.T) {
+	for _, test := range testPuzzles() {
+		for _, opts := range testOptions() {
+			naive := solveAll(t, NaiveSolver{}, test.puzzle, opts)
+			for _, workers := range []int{1, 2, 4} {
+				parallel := solveAll(t, ParallelSolver{Workers: workers}, test.puzzle, opts)
+				if !reflect.DeepEqual(parallel, naive) {
+					t.Errorf("%s, %s: %d workers find %d solutions, the naive solver %d", test.name, opts, workers,
+						len(parallel), len(naive))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tiling
+
+import (
+	"fmt"
+	"localhost/flobrm/tilingsolver/core"
+)
+
+//Presolve checks a puzzle for reasons it can't have any solution, without searching it. It returns nil if the
+//search is needed, or an error that says why the puzzle is infeasible:
+//the tiles don't cover exactly the area of the board, a tile doesn't fit on the board in a way its Rotation allows,
+//or no subset of the tiles can line up along the width or the height of the board.
+//Jobs of a puzzle are checked as the whole puzzle, their Start and End are ignored.
+func Presolve(puzzle core.Puzzle) error {
+	board := puzzle.Board
+	if board.X <= 0 || board.Y <= 0 {
+		return fmt.Errorf("invalid board size %dx%d", board.X, board.Y)
+	}
+	if len(puzzle.Tiles) == 0 {
+		return fmt.Errorf("puzzle has no tiles")
+	}
+	rotation := func(i int) core.Rotation {
+		if len(puzzle.Rotations) == len(puzzle.Tiles) {
+			return puzzle.Rotations[i]
+		}
+		return core.RotationFree
+	}
+
+	area := 0
+	for i, tile := range puzzle.Tiles {
+		if tile.X <= 0 || tile.Y <= 0 {
+			return fmt.Errorf("tile %d has invalid size %dx%d", i, tile.X, tile.Y)
+		}
+		if !fitsFlat(tile, rotation(i), board) && !fitsUpright(tile, rotation(i), board) {
+			return fmt.Errorf("tile %d (%dx%d, %s) doesn't fit on the %dx%d board", i, tile.X, tile.Y, rotation(i),
+				board.X, board.Y)
+		}
+		area += tile.X * tile.Y
+	}
+	if area != board.X*board.Y {
+		return fmt.Errorf("the tiles cover an area of %d, the %dx%d board has %d", area, board.X, board.Y, board.X*board.Y)
+	}
+
+	//the tiles along the bottom edge fill the width exactly, and the ones along the left edge the height
+	if !edgeFillable(puzzle.Tiles, rotation, board, false) {
+		return fmt.Errorf("no set of tiles adds up to the board width %d", board.X)
+	}
+	if !edgeFillable(puzzle.Tiles, rotation, board, true) {
+		return fmt.Errorf("no set of tiles adds up to the board height %d", board.Y)
+	}
+	return nil
+}
+
+//infeasibleResult returns the Result of a solver for a puzzle that Presolve rejects, and whether it rejects it
+func infeasibleResult(puzzle core.Puzzle) (Result, bool) {
+	if err := Presolve(puzzle); err != nil {
+		return Result{Status: "infeasible", Reason: err.Error()}, true
+	}
+	return Result{}, false
+}
+
+//fitsFlat returns whether tile can be placed flat, with X along the board width
+func fitsFlat(tile core.Coord, rotation core.Rotation, board core.Coord) bool {
+	return rotation.Allows(false) && tile.X <= board.X && tile.Y <= board.Y
+}
+
+//fitsUpright returns whether tile can be placed upright, with X along the board height
+func fitsUpright(tile core.Coord, rotation core.Rotation, board core.Coord) bool {
+	return rotation.Allows(true) && tile.Y <= board.X && tile.X <= board.Y
+}
+
+//edgeFillable returns whether a subset of tiles, each placed in a way that fits the board, has sides that add up to
+//the board width exactly, or the board height if vertical is set
+func edgeFillable(tiles []core.Coord, rotation func(int) core.Rotation, board core.Coord, vertical bool) bool {
+	length := board.X
+	if vertical {
+		length = board.Y
+	}
+	reachable := make([]bool, length+1) //reachable[n]: some of the tiles so far add up to n
+	reachable[0] = true
+	for i, tile := range tiles {
+		var sides []int
+		if fitsFlat(tile, rotation(i), board) {
+			if vertical {
+				sides = append(sides, tile.Y)
+			} else {
+				sides = append(sides, tile.X)
+			}
+		}
+		if fitsUpright(tile, rotation(i), board) {
+			if vertical {
+				sides = append(sides, tile.X)
+			} else {
+				sides = append(sides, tile.Y)
+			}
+		}
+		for n := length; n > 0; n-- { //downwards, so every tile is used at most once
+			for _, side := range sides {
+				if side <= n && reachable[n-side] {
+					reachable[n] = true
+				}
+			}
+		}
+		if reachable[length] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package tiling
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+	"time"
+)
+
+//Progress reports the state of a running search, so it can be continued from there if the process dies.
+//Report is called every Nodes tiles placed and every Interval, whichever comes first. A zero Nodes or Interval
+//disables that trigger, and a nil Report disables progress reports.
+type Progress struct {
+	Nodes    uint
+	Interval time.Duration
+	Report   func(currentState []core.TilePlacement, tilesPlaced uint)
+}
+
+//progressTracker decides when the next progress report is due
+type progressTracker struct {
+	progress  Progress
+	nextNodes uint
+	nextTime  time.Time
+	steps     uint
+}
+
+func newProgressTracker(progress Progress) progressTracker {
+	tracker := progressTracker{progress: progress}
+	tracker.reset(0)
+	return tracker
+}
+
+//due returns whether a report is due after tilesPlaced tiles, the clock is only read once every 1024 calls
+func (t *progressTracker) due(tilesPlaced uint) bool {
+	if t.progress.Report == nil {
+		return false
+	}
+	if t.progress.Nodes > 0 && tilesPlaced >= t.nextNodes {
+		return true
+	}
+	t.steps++
+	return t.progress.Interval > 0 && t.steps%1024 == 0 && time.Now().After(t.nextTime)
+}
+
+//reset schedules the next report after a report at tilesPlaced tiles
+func (t *progressTracker) reset(tilesPlaced uint) {
+	t.nextNodes = tilesPlaced + t.progress.Nodes
+	t.nextTime = time.Now().Add(t.progress.Interval)
+}
@@ -0,0 +1,86 @@
+package tiling
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"hash/fnv"
+)
+
+//solutionSet remembers a hash of every canonical solution found, to filter duplicates
+type solutionSet struct {
+	hashes       map[[sha1.Size]byte]struct{}
+	fingerprints map[[16]byte]struct{} //used instead of hashes in count only mode
+}
+
+//newSolutionSet returns a set that hashes the json of solutions with sha1, like the solutions output,
+//or in count only mode a smaller fingerprint that is cheaper to compute
+func newSolutionSet(countOnly bool) solutionSet {
+	if countOnly {
+		return solutionSet{fingerprints: make(map[[16]byte]struct{})}
+	}
+	return solutionSet{hashes: make(map[[sha1.Size]byte]struct{})}
+}
+
+//add remembers solution and returns whether it wasn't in the set yet
+func (s solutionSet) add(solution []Tile) bool {
+	if s.fingerprints != nil {
+		solutionFingerprint := fingerprint(solution)
+		if _, found := s.fingerprints[solutionFingerprint]; found {
+			return false
+		}
+		s.fingerprints[solutionFingerprint] = struct{}{}
+		return true
+	}
+	solutionHash := sha1.Sum([]byte(TileSliceToJSON(solution)))
+	if _, found := s.hashes[solutionHash]; found {
+		return false
+	}
+	s.hashes[solutionHash] = struct{}{}
+	return true
+}
+
+//fingerprint is a 128 bit FNV-1a hash of the position and rotation of every tile in solution.
+//The tile sizes are left out, they are the same for every solution of a puzzle.
+func fingerprint(solution []Tile) (sum [16]byte) {
+	hasher := fnv.New128a()
+	var tileBytes [17]byte
+	for i := range solution {
+		binary.LittleEndian.PutUint64(tileBytes[0:], uint64(solution[i].X))
+		binary.LittleEndian.PutUint64(tileBytes[8:], uint64(solution[i].Y))
+		tileBytes[16] = 0
+		if solution[i].Turned {
+			tileBytes[16] = 1
+		}
+		hasher.Write(tileBytes[:])
+	}
+	hasher.Sum(sum[:0])
+	return sum
+}
+
+//solutionCounter counts the solutions a Solver finds, and with countCorners the solutions per corner tile
+type solutionCounter struct {
+	solutions    int
+	cornerCounts []int
+}
+
+func newSolutionCounter(numTiles int, countCorners bool) solutionCounter {
+	counter := solutionCounter{}
+	if countCorners {
+		counter.cornerCounts = make([]int, numTiles)
+	}
+	return counter
+}
+
+//add counts a canonical solution, its corner tile is the one in the bottom left corner
+func (c *solutionCounter) add(solution []Tile) {
+	c.solutions++
+	if c.cornerCounts == nil {
+		return
+	}
+	for i := range solution {
+		if solution[i].X == 0 && solution[i].Y == 0 {
+			c.cornerCounts[i]++
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tiling
+
+import (
+	"context"
+	"localhost/flobrm/tilingsolver/core"
+)
+
+//Result describes how a Solver finished a puzzle or job
+type Result struct {
+	Status       string               //solved, solved1, interrupted or infeasible
+	TilesPlaced  uint                 //number of tiles placed (and possibly removed again)
+	CurrentState []core.TilePlacement //the tiles on the board when the solver stopped, can be used as a new start
+	Solutions    int                  //number of distinct solutions found
+	CornerCounts []int                //with Options.CountCorners, the number of solutions per tile in the bottom left corner
+	Stats        *SearchStats         //with Options.SearchStats, what the search did
+	Reason       string               //why the puzzle is infeasible
+}
+
+//Solver is a search algorithm for perfect rectangle packings. Implementations should hand every canonical solution
+//to sink once, or only count them with Options.CountOnly, and return status "interrupted" with a CurrentState to resume from when ctx is done.
+//While searching they report a state to resume from to progress, if it has a Report function.
+//Puzzles that Presolve rejects get status "infeasible" with the Reason, without searching.
+type Solver interface {
+	Solve(ctx context.Context, puzzle core.Puzzle, opts Options, sink SolutionSink, progress Progress) (Result, error)
+}
+
+//SolverOptions maps command line names to the available solvers
+var SolverOptions = map[string]Solver{
+	"naive":    NaiveSolver{},
+	"parallel": ParallelSolver{},
+}
+
+//NaiveSolver implements Solver with the depth first search of SolveNaiveStream
+type NaiveSolver struct{}
+
+//Solve runs the search of SolveNaiveStream on puzzle
+func (NaiveSolver) Solve(ctx context.Context, puzzle core.Puzzle, opts Options, sink SolutionSink,
+	progress Progress) (Result, error) {
+	if result, infeasible := infeasibleResult(puzzle); infeasible {
+		return result, nil
+	}
+	result := Result{}
+	counter := newSolutionCounter(len(puzzle.Tiles), opts.CountCorners)
+	countingSink := func(solution []Tile) error {
+		counter.add(solution)
+		if opts.CountOnly {
+			return nil
+		}
+		return sink(solution)
+	}
+	hooks := searchHooks{progress: progress}
+	if opts.SearchStats {
+		result.Stats = &SearchStats{}
+		hooks.stats = result.Stats
+	}
+	status, tilesPlaced, currentState, err := solveNaive(ctx, puzzle, opts, countingSink, hooks)
+	result.Status = status
+	result.TilesPlaced = tilesPlaced
+	result.CurrentState = currentState
+	result.Solutions = counter.solutions
+	result.CornerCounts = counter.cornerCounts
+	return result, err
+}
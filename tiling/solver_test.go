@@ -0,0 +1,88 @@
+package tiling
+
+import (
+	"context"
+	"localhost/flobrm/tilingsolver/core"
+	"reflect"
+	"testing"
+)
+
+//searchCount is how many solutions a search finds and how many tiles it places
+type searchCount struct {
+	solutions   int
+	tilesPlaced uint
+}
+
+//solverPuzzles have several solutions and take the search a few hundred tiles at most. Their counts are what the grid
+//finds with the default options and without the same side neighbor check, the solutions without the check are all
+//solutions of the puzzle.
+var solverPuzzles = []struct {
+	testPuzzle
+	counts [2]searchCount
+}{
+	{testPuzzle{"square board", core.Puzzle{
+		Board: core.Coord{X: 8, Y: 8},
+		Tiles: []core.Coord{{X: 5, Y: 3}, {X: 5, Y: 3}, {X: 5, Y: 2}, {X: 3, Y: 5}, {X: 3, Y: 3}},
+	}}, [2]searchCount{{4, 99}, {5, 172}}},
+	{testPuzzle{"wide board", core.Puzzle{
+		Board: core.Coord{X: 10, Y: 6},
+		Tiles: []core.Coord{{X: 6, Y: 2}, {X: 5, Y: 4}, {X: 5, Y: 1}, {X: 4, Y: 3}, {X: 4, Y: 2}, {X: 3, Y: 1}},
+	}}, [2]searchCount{{13, 387}, {23, 542}}},
+	{testPuzzle{"tiles of the same size", core.Puzzle{
+		Board: core.Coord{X: 6, Y: 7},
+		Tiles: []core.Coord{{X: 3, Y: 2}, {X: 3, Y: 2}, {X: 3, Y: 2}, {X: 3, Y: 2}, {X: 2, Y: 2}, {X: 2, Y: 2},
+			{X: 2, Y: 2}, {X: 6, Y: 1}},
+	}}, [2]searchCount{{8, 249}, {8, 390}}},
+}
+
+//testPuzzles returns all fixed puzzles of the tests
+func testPuzzles() []testPuzzle {
+	var puzzles []testPuzzle
+	for _, test := range solverPuzzles {
+		puzzles = append(puzzles, test.testPuzzle)
+	}
+	puzzles = append(puzzles, ssnPuzzles...)
+	return append(puzzles, rotationPuzzles...)
+}
+
+//testOptions returns the default options, and the default options without the same side neighbor check
+func testOptions() []Options {
+	noSSN := DefaultOptions()
+	noSSN.FullSSNCheck = false
+	return []Options{DefaultOptions(), noSSN}
+}
+
+func TestOccupancyCounts(t *testing.T) {
+	for _, test := range solverPuzzles {
+		for i, opts := range testOptions() {
+			for _, occupancy := range []string{OccupancyGrid, OccupancyBitboard} {
+				opts.Occupancy = occupancy
+				result, err := NaiveSolver{}.Solve(context.Background(), test.puzzle, opts,
+					func(solution []Tile) error { return nil }, Progress{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if count := (searchCount{result.Solutions, result.TilesPlaced}); count != test.counts[i] {
+					t.Errorf("%s, %s: %d solutions with %d tiles placed, expected %d with %d", test.name, opts,
+						count.solutions, count.tilesPlaced, test.counts[i].solutions, test.counts[i].tilesPlaced)
+				}
+			}
+		}
+	}
+}
+
+func TestOccupancyImplementationsAgree(t *testing.T) {
+	for _, test := range testPuzzles() {
+		for _, opts := range testOptions() {
+			opts.Occupancy = OccupancyGrid
+			grid := solveAll(t, NaiveSolver{}, test.puzzle, opts)
+			if len(grid) == 0 && !opts.FullSSNCheck {
+				t.Errorf("%s: no solutions found", test.name)
+			}
+			opts.Occupancy = OccupancyBitboard
+			if bitboard := solveAll(t, NaiveSolver{}, test.puzzle, opts); !reflect.DeepEqual(bitboard, grid) {
+				t.Errorf("%s, %s: the bitboard finds %d solutions, the grid %d", test.name, opts, len(bitboard), len(grid))
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tiling
+
+import (
+	"context"
+	"errors"
+	"localhost/flobrm/tilingsolver/core"
+)
+
+//EnumeratePrefixes returns every placement of depth tiles the naive solver visits while solving puzzle with opts,
+//in the order it visits them. It only looks between puzzle.Start and puzzle.End, and Start itself is not included.
+//The same pruning rules as the solver are used, so the prefixes are exactly the nodes of its search tree at depth.
+//The solver only checks End when it has placed as many tiles as End has, so depth can't be less than len(End).
+func EnumeratePrefixes(ctx context.Context, puzzle core.Puzzle, opts Options, depth int) ([][]core.TilePlacement, error) {
+	if depth <= 0 || depth > len(puzzle.Tiles) {
+		return nil, errors.New("depth should be between 1 and the number of tiles")
+	}
+	if depth < len(puzzle.End) {
+		return nil, errors.New("depth can't be smaller than the length of end")
+	}
+	prefixes := make([][]core.TilePlacement, 0)
+	hooks := searchHooks{
+		prefixDepth: depth,
+		onPrefix: func(prefix []core.TilePlacement) error {
+			prefixes = append(prefixes, prefix)
+			return nil
+		},
+	}
+	opts.StopOnSolution = false
+	ignoreSolutions := func(solution []Tile) error { return nil }
+	status, _, _, err := solveNaive(ctx, puzzle, opts, ignoreSolutions, hooks)
+	if err != nil {
+		return nil, err
+	}
+	if status == "interrupted" {
+		return nil, ctx.Err()
+	}
+	return prefixes, nil
+}
+
+//SplitAtDepth splits puzzle into jobs that each start at a prefix of depth tiles, as found by EnumeratePrefixes.
+//Consecutive prefixes are grouped so there are at most maxJobs jobs, if maxJobs <= 0 there is one job per prefix.
+//The first job starts at puzzle.Start and the last ends at puzzle.End, together the jobs cover that range exactly once.
+func SplitAtDepth(ctx context.Context, puzzle core.Puzzle, opts Options, depth int, maxJobs int) ([]core.Puzzle, error) {
+	prefixes, err := EnumeratePrefixes(ctx, puzzle, opts, depth)
+	if err != nil {
+		return nil, err
+	}
+	return groupPrefixes(puzzle, prefixes, maxJobs), nil
+}
+
+//SplitPuzzle splits puzzle into numJobs jobs, or fewer if the search tree is too small.
+//It uses the smallest depth that has at least numJobs prefixes, so the jobs are as large as possible.
+func SplitPuzzle(ctx context.Context, puzzle core.Puzzle, opts Options, numJobs int) ([]core.Puzzle, error) {
+	if numJobs <= 1 || len(puzzle.Tiles) == 0 {
+		return []core.Puzzle{puzzle}, nil
+	}
+	var prefixes [][]core.TilePlacement
+	for depth := Max(1, len(puzzle.End)); depth <= len(puzzle.Tiles); depth++ {
+		depthPrefixes, err := EnumeratePrefixes(ctx, puzzle, opts, depth)
+		if err != nil {
+			return nil, err
+		}
+		if len(depthPrefixes) > len(prefixes) {
+			prefixes = depthPrefixes
+		}
+		if len(prefixes) >= numJobs {
+			break
+		}
+	}
+	return groupPrefixes(puzzle, prefixes, numJobs), nil
+}
+
+//groupPrefixes divides prefixes into at most maxJobs evenly sized groups, and turns every group into a job.
+func groupPrefixes(puzzle core.Puzzle, prefixes [][]core.TilePlacement, maxJobs int) []core.Puzzle {
+	if maxJobs <= 0 || maxJobs > len(prefixes) {
+		maxJobs = len(prefixes)
+	}
+	if maxJobs <= 1 {
+		return []core.Puzzle{puzzle}
+	}
+	jobs := make([]core.Puzzle, maxJobs)
+	jobStart := puzzle.Start
+	for i := range jobs {
+		jobs[i] = puzzle
+		jobs[i].Start = jobStart
+		if i < maxJobs-1 {
+			jobStart = prefixes[(i+1)*len(prefixes)/maxJobs]
+			jobs[i].End = jobStart
+		}
+	}
+	return jobs
+}
+
+//comparePlacements compares placement sequences in the order the naive solver visits them, by tile index and then
+//rotation, and a sequence comes before the longer sequences it is the start of. If turnedFirst is set rotated tiles come
+//before unrotated ones, which is the order on boards the solver flipped upright.
+//It returns -1 if a comes first, 1 if b comes first and 0 if they are equal.
+func comparePlacements(a, b []core.TilePlacement, turnedFirst bool) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Idx != b[i].Idx {
+			if a[i].Idx < b[i].Idx {
+				return -1
+			}
+			return 1
+		}
+		if a[i].Rot != b[i].Rot {
+			if a[i].Rot == turnedFirst {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+//ComparePlacements compares placements of the tiles of puzzle in the order the naive solver visits them with opts.
+//It returns -1 if a comes first, 1 if b comes first and 0 if they are equal.
+func ComparePlacements(puzzle core.Puzzle, opts Options, a, b []core.TilePlacement) int {
+	order := newTileOrder(puzzle, opts.TileOrder)
+	return order.comparePlacements(a, b, opts.ForceFrameUpright && puzzle.Board.X > puzzle.Board.Y)
+}
@@ -0,0 +1,92 @@
+package tiling
+
+import (
+	"context"
+	"localhost/flobrm/tilingsolver/core"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+//solveJobs solves every job, and returns the distinct solutions of all jobs together, sorted. Jobs can find the same
+//canonical solution as a different version of it, the solver only filters those within a job.
+func solveJobs(t *testing.T, jobs []core.Puzzle, opts Options) []string {
+	t.Helper()
+	found := make(map[string]bool)
+	var solutions []string
+	for _, job := range jobs {
+		for _, solution := range solveAll(t, NaiveSolver{}, job, opts) {
+			if !found[solution] {
+				found[solution] = true
+				solutions = append(solutions, solution)
+			}
+		}
+	}
+	sort.Strings(solutions)
+	return solutions
+}
+
+//checkJobRanges checks that jobs follow each other in the order of the search, from the start to the end of puzzle,
+//and that every prefix is in the range of exactly one job
+func checkJobRanges(t *testing.T, name string, puzzle core.Puzzle, opts Options, jobs []core.Puzzle,
+	prefixes [][]core.TilePlacement) {
+	t.Helper()
+	if !reflect.DeepEqual(jobs[0].Start, puzzle.Start) || !reflect.DeepEqual(jobs[len(jobs)-1].End, puzzle.End) {
+		t.Errorf("%s: jobs cover %v to %v, the puzzle %v to %v", name, jobs[0].Start, jobs[len(jobs)-1].End,
+			puzzle.Start, puzzle.End)
+	}
+	for i := 0; i < len(jobs)-1; i++ {
+		if !reflect.DeepEqual(jobs[i+1].Start, jobs[i].End) {
+			t.Errorf("%s: job %d ends at %v, job %d starts at %v", name, i, jobs[i].End, i+1, jobs[i+1].Start)
+		}
+		if ComparePlacements(puzzle, opts, jobs[i].Start, jobs[i].End) >= 0 {
+			t.Errorf("%s: job %d ends at %v, before its start %v", name, i, jobs[i].End, jobs[i].Start)
+		}
+	}
+	for _, prefix := range prefixes {
+		covered := 0
+		for _, job := range jobs {
+			if ComparePlacements(puzzle, opts, job.Start, prefix) <= 0 &&
+				(job.End == nil || ComparePlacements(puzzle, opts, prefix, job.End) < 0) {
+				covered++
+			}
+		}
+		if covered != 1 {
+			t.Errorf("%s: prefix %v is in %d jobs", name, prefix, covered)
+		}
+	}
+}
+
+func TestSplitJobsCoverTheSearchOnce(t *testing.T) {
+	for _, test := range testPuzzles() {
+		for _, opts := range testOptions() {
+			whole := solveJobs(t, []core.Puzzle{test.puzzle}, opts)
+			for depth := 1; depth <= 3; depth++ {
+				for _, maxJobs := range []int{0, 3} {
+					jobs, err := SplitAtDepth(context.Background(), test.puzzle, opts, depth, maxJobs)
+					if err != nil {
+						t.Fatal(err)
+					}
+					prefixes, err := EnumeratePrefixes(context.Background(), test.puzzle, opts, depth)
+					if err != nil {
+						t.Fatal(err)
+					}
+					checkJobRanges(t, test.name, test.puzzle, opts, jobs, prefixes)
+					if solutions := solveJobs(t, jobs, opts); !reflect.DeepEqual(solutions, whole) {
+						t.Errorf("%s, %s: %d jobs at depth %d find %d solutions, the whole puzzle %d", test.name, opts,
+							len(jobs), depth, len(solutions), len(whole))
+					}
+				}
+			}
+			jobs, err := SplitPuzzle(context.Background(), test.puzzle, opts, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkJobRanges(t, test.name, test.puzzle, opts, jobs, nil)
+			if solutions := solveJobs(t, jobs, opts); !reflect.DeepEqual(solutions, whole) {
+				t.Errorf("%s, %s: %d split jobs find %d solutions, the whole puzzle %d", test.name, opts, len(jobs),
+					len(solutions), len(whole))
+			}
+		}
+	}
+}
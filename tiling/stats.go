@@ -0,0 +1,90 @@
+package tiling
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+//SearchStats counts what the search did, with Options.SearchStats. Every placement that is rejected is counted by
+//the first rule that rejected it, so the counts show how often each pruning rule fires.
+type SearchStats struct {
+	NodesPerDepth []uint `json:"nodes_per_depth"` //tiles placed with i tiles already on the board, these add up to TilesPlaced
+	Backtracks    uint   `json:"backtracks"`      //tiles removed because nothing fit after them
+	BoardBounds   uint   `json:"board_bounds"`    //placements sticking out of the board
+	GapWidth      uint   `json:"gap_width"`       //placements wider than the gap they were placed in
+	CornerRule    uint   `json:"corner_rule"`     //corner tiles with a lower index than the bottom left corner tile
+	SSNTree       uint   `json:"ssn_tree"`        //placements that make an illegal same side neighbor pair
+	NextGap       uint   `json:"next_gap"`        //placements that leave an unfillable next gap
+	AllGaps       uint   `json:"all_gaps"`        //placements that leave any unfillable gap, with AllDownGapCheck
+	LeftSideGaps  uint   `json:"left_side_gaps"`  //placements that leave an unfillable gap on the left side of a tile
+	TotalGapArea  uint   `json:"total_gap_area"`  //placements that leave more gap area than the remaining tiles can fill
+}
+
+//addNode counts a tile placed with depth tiles already on the board
+func (s *SearchStats) addNode(depth int) {
+	for len(s.NodesPerDepth) <= depth {
+		s.NodesPerDepth = append(s.NodesPerDepth, 0)
+	}
+	s.NodesPerDepth[depth]++
+}
+
+//Add adds the counts of other to s
+func (s *SearchStats) Add(other *SearchStats) {
+	for len(s.NodesPerDepth) < len(other.NodesPerDepth) {
+		s.NodesPerDepth = append(s.NodesPerDepth, 0)
+	}
+	for depth, nodes := range other.NodesPerDepth {
+		s.NodesPerDepth[depth] += nodes
+	}
+	s.Backtracks += other.Backtracks
+	s.BoardBounds += other.BoardBounds
+	s.GapWidth += other.GapWidth
+	s.CornerRule += other.CornerRule
+	s.SSNTree += other.SSNTree
+	s.NextGap += other.NextGap
+	s.AllGaps += other.AllGaps
+	s.LeftSideGaps += other.LeftSideGaps
+	s.TotalGapArea += other.TotalGapArea
+}
+
+//Nodes is the total number of tiles placed, the sum of NodesPerDepth
+func (s *SearchStats) Nodes() uint {
+	total := uint(0)
+	for _, nodes := range s.NodesPerDepth {
+		total += nodes
+	}
+	return total
+}
+
+//WriteTable prints the nodes per depth and the rejections per rule as two aligned tables
+func (s *SearchStats) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "depth\tnodes")
+	for depth, nodes := range s.NodesPerDepth {
+		fmt.Fprintf(tw, "%d\t%d\n", depth, nodes)
+	}
+	fmt.Fprintf(tw, "total\t%d\n", s.Nodes())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	rows := []struct {
+		name  string
+		count uint
+	}{
+		{"backtracks", s.Backtracks},
+		{"rejected by board bounds", s.BoardBounds},
+		{"rejected by gap width", s.GapWidth},
+		{"rejected by corner rule", s.CornerRule},
+		{"rejected by ssn tree", s.SSNTree},
+		{"rejected by next gap", s.NextGap},
+		{"rejected by all gaps", s.AllGaps},
+		{"rejected by left side gaps", s.LeftSideGaps},
+		{"rejected by total gap area", s.TotalGapArea},
+	}
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%d\n", row.name, row.count)
+	}
+	return tw.Flush()
+}
@@ -10,11 +10,12 @@ import (
  */
 type Tile struct {
 	W, H, X, Y             int
-	CurW                   int  `json:"-"`
-	CurH                   int  `json:"-"`
-	Placed                 bool `json:"-"`
-	Turned                 bool `json:"T"`
-	Index                  int  `json:"-"`
+	CurW                   int           `json:"-"`
+	CurH                   int           `json:"-"`
+	Placed                 bool          `json:"-"`
+	Turned                 bool          `json:"T"`
+	Index                  int           `json:"-"`
+	Rotation               core.Rotation `json:"-"` //the ways the tile may be placed, a square tile is always free
 	parent, lChild, rChild *Tile
 }
 
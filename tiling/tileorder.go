@@ -0,0 +1,170 @@
+package tiling
+
+import (
+	"fmt"
+	"localhost/flobrm/tilingsolver/core"
+	"sort"
+)
+
+//Orders the search tries the tiles in, see Options.TileOrder. Every order except input puts the larger tiles first,
+//and tiles of the same size next to each other so the search can skip equal tiles.
+const (
+	TileOrderInput       = "input"        //the order of the puzzle, the default
+	TileOrderArea        = "area"         //largest area first
+	TileOrderLongestSide = "longest_side" //longest side first, then the shortest side
+	TileOrderPerimeter   = "perimeter"    //largest perimeter first
+)
+
+//validTileOrder checks if order is one of the TileOrder constants, the empty string is the same as input
+func validTileOrder(order string) error {
+	switch order {
+	case "", TileOrderInput, TileOrderArea, TileOrderLongestSide, TileOrderPerimeter:
+		return nil
+	}
+	return fmt.Errorf("unknown tile order %q, expected %s, %s, %s or %s", order, TileOrderInput, TileOrderArea,
+		TileOrderLongestSide, TileOrderPerimeter)
+}
+
+//tileOrder maps the tiles of a puzzle as the caller passed them to the tiles the search uses, and back.
+//In the search every tile has X >= Y, and the tiles are sorted by one of the TileOrder constants.
+//A tile whose X and Y are swapped is placed flat in the search when the caller's tile is upright, and the other way
+//around, so its rotation is inverted in placements and its Rotation is transposed.
+type tileOrder struct {
+	searchIdx []int  //searchIdx[i] is the index in the search of tile i of the puzzle
+	puzzleIdx []int  //puzzleIdx[i] is the index in the puzzle of tile i of the search
+	swapped   []bool //swapped[i] is set if tile i of the puzzle has X < Y
+}
+
+func newTileOrder(puzzle core.Puzzle, order string) tileOrder {
+	tiles := puzzle.Tiles
+	o := tileOrder{
+		searchIdx: make([]int, len(tiles)),
+		puzzleIdx: make([]int, len(tiles)),
+		swapped:   make([]bool, len(tiles)),
+	}
+	normalized := make([]core.Coord, len(tiles))
+	for i, tile := range tiles {
+		o.puzzleIdx[i] = i
+		o.swapped[i] = tile.X < tile.Y
+		normalized[i] = tile
+		if o.swapped[i] {
+			normalized[i] = core.Coord{X: tile.Y, Y: tile.X}
+		}
+	}
+	rotation := func(i int) core.Rotation { //of the normalized tile
+		if len(puzzle.Rotations) != len(tiles) || tiles[i].X == tiles[i].Y {
+			return core.RotationFree
+		}
+		if o.swapped[i] {
+			return puzzle.Rotations[i].Transposed()
+		}
+		return puzzle.Rotations[i]
+	}
+	var key func(tile core.Coord) int
+	switch order {
+	case TileOrderArea:
+		key = func(tile core.Coord) int { return tile.X * tile.Y }
+	case TileOrderLongestSide:
+		key = func(tile core.Coord) int { return tile.X }
+	case TileOrderPerimeter:
+		key = func(tile core.Coord) int { return tile.X + tile.Y }
+	}
+	if key != nil {
+		//equal keys are ordered by size and rotation, so the order doesn't depend on the order of the puzzle and tiles
+		//of the same size end up next to each other
+		sort.SliceStable(o.puzzleIdx, func(a, b int) bool {
+			tileA, tileB := normalized[o.puzzleIdx[a]], normalized[o.puzzleIdx[b]]
+			if keyA, keyB := key(tileA), key(tileB); keyA != keyB {
+				return keyA > keyB
+			}
+			if tileA.X != tileB.X {
+				return tileA.X > tileB.X
+			}
+			if tileA.Y != tileB.Y {
+				return tileA.Y > tileB.Y
+			}
+			return rotation(o.puzzleIdx[a]) < rotation(o.puzzleIdx[b])
+		})
+	}
+	for i, idx := range o.puzzleIdx {
+		o.searchIdx[idx] = i
+	}
+	return o
+}
+
+//searchPuzzle returns puzzle with its tiles, rotations, start and end as the search sees them
+func (o tileOrder) searchPuzzle(puzzle core.Puzzle) core.Puzzle {
+	search := puzzle
+	search.Tiles = make([]core.Coord, len(puzzle.Tiles))
+	for i, idx := range o.puzzleIdx {
+		search.Tiles[i] = puzzle.Tiles[idx]
+		if o.swapped[idx] {
+			search.Tiles[i] = core.Coord{X: puzzle.Tiles[idx].Y, Y: puzzle.Tiles[idx].X}
+		}
+	}
+	if len(puzzle.Rotations) == len(puzzle.Tiles) {
+		search.Rotations = make([]core.Rotation, len(puzzle.Rotations))
+		for i, idx := range o.puzzleIdx {
+			switch {
+			case search.Tiles[i].X == search.Tiles[i].Y: //square tiles look the same both ways
+				search.Rotations[i] = core.RotationFree
+			case o.swapped[idx]:
+				search.Rotations[i] = puzzle.Rotations[idx].Transposed()
+			default:
+				search.Rotations[i] = puzzle.Rotations[idx]
+			}
+		}
+	}
+	search.Start = o.searchPlacements(puzzle.Start)
+	search.End = o.searchPlacements(puzzle.End)
+	return search
+}
+
+//searchPlacements maps placements of the tiles of the puzzle to the tiles of the search. Placements of tiles that
+//don't exist are kept as they are, the search handles them.
+func (o tileOrder) searchPlacements(placements []core.TilePlacement) []core.TilePlacement {
+	if placements == nil {
+		return nil
+	}
+	search := make([]core.TilePlacement, len(placements))
+	for i, placement := range placements {
+		search[i] = placement
+		if placement.Idx >= 0 && placement.Idx < len(o.searchIdx) {
+			search[i] = core.TilePlacement{Idx: o.searchIdx[placement.Idx], Rot: placement.Rot != o.swapped[placement.Idx]}
+		}
+	}
+	return search
+}
+
+//puzzlePlacements maps placements of the tiles of the search back to the tiles of the puzzle
+func (o tileOrder) puzzlePlacements(placements []core.TilePlacement) []core.TilePlacement {
+	if placements == nil {
+		return nil
+	}
+	puzzle := make([]core.TilePlacement, len(placements))
+	for i, placement := range placements {
+		idx := o.puzzleIdx[placement.Idx]
+		puzzle[i] = core.TilePlacement{Idx: idx, Rot: placement.Rot != o.swapped[idx]}
+	}
+	return puzzle
+}
+
+//puzzleTiles writes the tiles of the search to puzzle in the order and the orientation of the tiles of the puzzle
+func (o tileOrder) puzzleTiles(search []Tile, puzzle []Tile) {
+	for i, idx := range o.puzzleIdx {
+		puzzle[idx] = search[i]
+		puzzle[idx].Index = idx
+		if o.swapped[idx] {
+			tile := &puzzle[idx]
+			tile.W, tile.H = tile.H, tile.W
+			tile.Turned = !tile.Turned
+			tile.Rotation = tile.Rotation.Transposed()
+		}
+	}
+}
+
+//comparePlacements compares placements of the tiles of the puzzle in the order the search visits them, see the
+//function comparePlacements
+func (o tileOrder) comparePlacements(a, b []core.TilePlacement, turnedFirst bool) int {
+	return comparePlacements(o.searchPlacements(a), o.searchPlacements(b), turnedFirst)
+}
@@ -0,0 +1,86 @@
+package tiling
+
+import (
+	"context"
+	"localhost/flobrm/tilingsolver/core"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+//shuffledPuzzle returns puzzle with its tiles in a random order, and some of them given with X and Y swapped
+func shuffledPuzzle(puzzle core.Puzzle, rng *rand.Rand) core.Puzzle {
+	shuffled := core.Puzzle{Board: puzzle.Board}
+	for _, i := range rng.Perm(len(puzzle.Tiles)) {
+		tile := puzzle.Tiles[i]
+		rotation := core.RotationFree
+		if len(puzzle.Rotations) > 0 {
+			rotation = puzzle.Rotations[i]
+		}
+		if rng.Intn(2) == 0 {
+			tile = core.Coord{X: tile.Y, Y: tile.X}
+			rotation = rotation.Transposed()
+		}
+		shuffled.Tiles = append(shuffled.Tiles, tile)
+		if len(puzzle.Rotations) > 0 {
+			shuffled.Rotations = append(shuffled.Rotations, rotation)
+		}
+	}
+	return shuffled
+}
+
+func TestTileOrderDoesNotDependOnInputOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	puzzles := append(append([]testPuzzle(nil), ssnPuzzles...), rotationPuzzles...)
+	for _, test := range puzzles {
+		for _, order := range []string{TileOrderArea, TileOrderLongestSide, TileOrderPerimeter} {
+			opts := DefaultOptions()
+			opts.TileOrder = order
+			opts.CountOnly = true
+			want, err := NaiveSolver{}.Solve(context.Background(), test.puzzle, opts, nil, Progress{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				shuffled := shuffledPuzzle(test.puzzle, rng)
+				search := newTileOrder(shuffled, order).searchPuzzle(shuffled)
+				wantSearch := newTileOrder(test.puzzle, order).searchPuzzle(test.puzzle)
+				if !reflect.DeepEqual(search, wantSearch) {
+					t.Errorf("%s, %s: the search gets %v for %v and %v for %v", test.name, order, search, shuffled,
+						wantSearch, test.puzzle)
+				}
+				result, err := NaiveSolver{}.Solve(context.Background(), shuffled, opts, nil, Progress{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 { //the solutions are mapped back to the shuffled tiles
+					solveOpts := opts
+					solveOpts.CountOnly = false
+					for _, solution := range solveAll(t, NaiveSolver{}, shuffled, solveOpts) {
+						for _, violation := range VerifyPuzzleSolution(shuffled, solutionTiles(t, shuffled, solution)) {
+							t.Errorf("%s, %s: %v in %s", test.name, order, violation, solution)
+						}
+					}
+				}
+				if result.Solutions != want.Solutions || result.TilesPlaced != want.TilesPlaced {
+					t.Errorf("%s, %s: %v gives %d solutions with %d tiles placed, %v gives %d with %d", test.name, order,
+						shuffled.Tiles, result.Solutions, result.TilesPlaced, test.puzzle.Tiles, want.Solutions,
+						want.TilesPlaced)
+				}
+			}
+		}
+	}
+}
+
+//TestDefaultTileOrderKeepsTheInputOrder checks that start, end and current_state written before tiles were sorted
+//still mean the same with the default options
+func TestDefaultTileOrderKeepsTheInputOrder(t *testing.T) {
+	for _, test := range testPuzzles() {
+		order := newTileOrder(test.puzzle, DefaultOptions().TileOrder)
+		for i, idx := range order.puzzleIdx {
+			if idx != i {
+				t.Errorf("%s: tile %d of the search is tile %d of the puzzle", test.name, i, idx)
+			}
+		}
+	}
+}
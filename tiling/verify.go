@@ -0,0 +1,103 @@
+package tiling
+
+import (
+	"fmt"
+	"localhost/flobrm/tilingsolver/core"
+)
+
+//VerifySolution checks that solution is a perfect packing of tiles on board, every tile can be turned.
+//See VerifyPuzzleSolution for the checks.
+func VerifySolution(board core.Coord, tiles []core.Coord, solution []Tile) []error {
+	return VerifyPuzzleSolution(core.Puzzle{Board: board, Tiles: tiles}, solution)
+}
+
+//VerifyPuzzleSolution checks that solution is a perfect packing of the tiles of puzzle on its board, and returns every
+//violation it finds, or nil if there are none. Tile i of the solution has to be tile i of the puzzle, either way
+//around, and placed the way puzzle.Rotations allows. The Rotation of the solution tiles is ignored.
+//No two tiles may overlap or stick out of the board, and together they have to cover every cell.
+func VerifyPuzzleSolution(puzzle core.Puzzle, solution []Tile) []error {
+	boardDims, tiles := puzzle.Board, puzzle.Tiles
+	var violations []error
+	if len(solution) != len(tiles) {
+		violations = append(violations, fmt.Errorf("solution has %d tiles, the puzzle has %d", len(solution), len(tiles)))
+	}
+	if boardDims.X <= 0 || boardDims.Y <= 0 {
+		return append(violations, fmt.Errorf("invalid board size %dx%d", boardDims.X, boardDims.Y))
+	}
+
+	owners := make([]int, boardDims.X*boardDims.Y) //tile index + 1 of the tile covering each cell, row by row
+	overlaps := make(map[[2]int]bool)
+	for i, tile := range solution {
+		if i < len(tiles) {
+			size := tiles[i]
+			if !(tile.W == size.X && tile.H == size.Y || tile.W == size.Y && tile.H == size.X) {
+				violations = append(violations, fmt.Errorf("tile %d is %dx%d, puzzle tile %d is %dx%d",
+					i, tile.W, tile.H, i, size.X, size.Y))
+			} else if rotation := puzzleRotation(puzzle, i); size.X != size.Y && !rotation.Allows(placedWidth(tile) != size.X) {
+				violations = append(violations, fmt.Errorf("tile %d can only be placed %s", i, rotation))
+			}
+		}
+		width, height := placedWidth(tile), placedHeight(tile)
+		if width <= 0 || height <= 0 {
+			violations = append(violations, fmt.Errorf("tile %d has no area", i))
+			continue
+		}
+		if tile.X < 0 || tile.Y < 0 || tile.X+width > boardDims.X || tile.Y+height > boardDims.Y {
+			violations = append(violations, fmt.Errorf("tile %d at (%d, %d) with size %dx%d sticks out of the %dx%d board",
+				i, tile.X, tile.Y, width, height, boardDims.X, boardDims.Y))
+		}
+		for y := Max(tile.Y, 0); y < Min(tile.Y+height, boardDims.Y); y++ {
+			for x := Max(tile.X, 0); x < Min(tile.X+width, boardDims.X); x++ {
+				cell := y*boardDims.X + x
+				if owners[cell] != 0 {
+					pair := [2]int{owners[cell] - 1, i}
+					if !overlaps[pair] {
+						overlaps[pair] = true
+						violations = append(violations, fmt.Errorf("tiles %d and %d overlap at (%d, %d)", pair[0], i, x, y))
+					}
+					continue
+				}
+				owners[cell] = i + 1
+			}
+		}
+	}
+
+	uncovered := 0
+	var first core.Coord
+	for cell, owner := range owners {
+		if owner == 0 {
+			if uncovered == 0 {
+				first = core.Coord{X: cell % boardDims.X, Y: cell / boardDims.X}
+			}
+			uncovered++
+		}
+	}
+	if uncovered > 0 {
+		violations = append(violations, fmt.Errorf("%d cells aren't covered, the first at (%d, %d)", uncovered, first.X, first.Y))
+	}
+	return violations
+}
+
+//puzzleRotation returns the rotation policy of tile i of puzzle
+func puzzleRotation(puzzle core.Puzzle, i int) core.Rotation {
+	if len(puzzle.Rotations) == len(puzzle.Tiles) {
+		return puzzle.Rotations[i]
+	}
+	return core.RotationFree
+}
+
+//placedWidth is the width a tile takes up on the board with its rotation
+func placedWidth(tile Tile) int {
+	if tile.Turned {
+		return tile.H
+	}
+	return tile.W
+}
+
+//placedHeight is the height a tile takes up on the board with its rotation
+func placedHeight(tile Tile) int {
+	if tile.Turned {
+		return tile.W
+	}
+	return tile.H
+}
@@ -0,0 +1,34 @@
+package tiling
+
+import (
+	"localhost/flobrm/tilingsolver/core"
+	"testing"
+)
+
+func TestVerifySolution(t *testing.T) {
+	board := core.Coord{X: 3, Y: 2}
+	tiles := []core.Coord{{X: 3, Y: 1}, {X: 1, Y: 3}}
+	tests := []struct {
+		name       string
+		solution   []Tile
+		violations int
+	}{
+		{"valid", []Tile{{W: 3, H: 1, X: 0, Y: 0}, {W: 1, H: 3, X: 0, Y: 1, Turned: true}}, 0},
+		{"missing tile", []Tile{{W: 3, H: 1, X: 0, Y: 0}}, 2},
+		{"wrong size", []Tile{{W: 3, H: 1, X: 0, Y: 0}, {W: 1, H: 2, X: 0, Y: 1, Turned: true}}, 2},
+		{"overlap", []Tile{{W: 3, H: 1, X: 0, Y: 0}, {W: 1, H: 3, X: 0, Y: 0, Turned: true}}, 2},
+		{"outside the board", []Tile{{W: 3, H: 1, X: 0, Y: 0}, {W: 1, H: 3, X: 0, Y: 1}}, 2},
+	}
+	for _, test := range tests {
+		violations := VerifySolution(board, tiles, test.solution)
+		if len(violations) != test.violations {
+			t.Errorf("%s: %d violations %v, expected %d", test.name, len(violations), violations, test.violations)
+		}
+	}
+
+	//the same solution is invalid if the second tile has to lie flat
+	puzzle := core.Puzzle{Board: board, Tiles: tiles, Rotations: []core.Rotation{core.RotationFree, core.RotationFlat}}
+	if violations := VerifyPuzzleSolution(puzzle, tests[0].solution); len(violations) != 1 {
+		t.Errorf("%d violations %v of a flat tile placed upright, expected 1", len(violations), violations)
+	}
+}
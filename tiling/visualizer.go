@@ -130,7 +130,10 @@ func savePicture(picture image.Image, filePath string) {
 //TestVisualizer is a temporary test function to build this thang
 func TestVisualizer() {
 
-	board := NewBoard(core.Coord{X: 16, Y: 15}, make([]Tile, 8)[:0], LastGapFirst)
+	board, err := NewBoard(core.Coord{X: 16, Y: 15}, make([]Tile, 8)[:0], LastGapFirst, OccupancyGrid)
+	if err != nil {
+		log.Fatal(err)
+	}
 	tileA := NewTile(9, 8)
 	tileA.Place(core.Coord{X: 0, Y: 1}, false)
 	board.Place(&tileA, false, false)
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,6 +16,8 @@ import (
 	"runtime/pprof"
 	"strings"
 	"time"
+
+	_ "github.com/go-sql-driver/mysql"
 )
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
@@ -23,36 +27,81 @@ var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 
 var numTiles = flag.Int("num_tiles", 0, "Solve only puzzles with this many tiles.")
 var puzzleLimit = flag.Int("puzzle_limit", 0, "Solve at most N puzzles")
+var puzzleIDs = flag.String("puzzle_ids", "", "Solve only puzzles with a puzzle_id in this comma separated list of ids and ranges, like 1-10,15,20-")
+var jobIDs = flag.String("job_ids", "", "Solve only jobs with a job_id in this comma separated list of ids and ranges")
+var boardWidths = flag.String("board_widths", "", "Solve only puzzles with a board width in this comma separated list of widths and ranges")
+var boardHeights = flag.String("board_heights", "", "Solve only puzzles with a board height in this comma separated list of heights and ranges")
+var skipPuzzles = flag.Int("skip", 0, "Skip the first N puzzles that pass the other filters")
+var strictInput = flag.Bool("strict_input", false, "Stop reading input at the first row that can't be read, instead of skipping it")
+var rejectFile = flag.String("reject_file", "", "Write input rows that are skipped to this csv file with their line number and the reason, instead of the log")
 var batchSize = flag.Int("batch_size", 1, "How many puzzles should the program reserve at once")
 var solverID = flag.Int("solver_id", 0, "Used to differentiate between different solvers and hardware")
 var useJobs = flag.Bool("jobs", false, "If set solve jobs instead of full puzzles")
 var dbstring = flag.String("dbstring", "tiler:tiler@(localhost:3306)/tiling", "Database connection string")
+var useDB = flag.Bool("use_db", false, "Reserve jobs from the jobs table in -dbstring and write the results to its tables, instead of -input_file")
+var reservationExpiry = flag.Int("reservation_expiry", 600, "Seconds a job reserved with -use_db stays reserved when its process stops renewing it, before other processes take it over, 0 never lets it expire")
+var coordinatorURL = flag.String("coordinator", "", "Lease jobs from the coordinator at this URL, like http://host:8080, and report the results to it, instead of -input_file")
 var processTimeout = flag.Int("process_timeout", 0, "Max time in seconds that the solver is allowed")
 var puzzleTimeout = flag.Int("puzzle_timeout", 0, "Max time before a puzzle/job is interrupted")
-var stopOnSolution = flag.Bool("stop_on_solution", false, "Stop the solver after finding the first solution")
-
-// Optimization flags
-var allSameSideNeighborCheck = flag.Bool("full_ssn_check", true, "set hierarchical same side neighbor check")
-var oneLevelSSNCheck = flag.Bool("1level_ssn_check", false, "set one level same side neighbor check") //TODO Not implemented yet
-var gapDetectionCheck = flag.Bool("gap_detection_check", true, "Enable gap detection, overrules more specific options")
-var nextGapDetectionCheck = flag.Bool("next_gap_check", true, "check the next gap where a tile will be placed")
-var allDownDetectionCheck = flag.Bool("all_down_gap_check", true, "check all normal gaps")
-var leftSideGapCheck = flag.Bool("left_side_gaps_check", true, "check gaps from the left side to the frame top")
-var totalGapAreaCheck = flag.Bool("total_gap_area_check", false, "check if the total gap area can be filled") //Turned of because it doesn't work or is never triggered
-var forceFrameUpright = flag.Bool("force_frame_upright", true, "Rotate the frame, start, and stop so the shortest frame side is used as the width.")
-var placementChoice = flag.String("placement_choice", "smallestGap", "The algorithm determining the position of the next tile. [lastGapAdded (default), smallestGap, bottomLeft]")
+
+var solverName = flag.String("solver", "naive", "The search algorithm used to solve puzzles. [naive, parallel]")
+var searchWorkers = flag.Int("search_workers", 0, "Number of workers that search a single puzzle together with -solver parallel, 0 uses all cpus")
+
+// Optimization flags, including stop_on_solution and placement_choice, are registered by tiling.Options
+var solverOptions = tiling.DefaultOptions()
+
+func init() {
+	solverOptions.RegisterFlags(flag.CommandLine)
+}
 
 // File based multithreaded options
 var numSolvers = flag.Int("workers", 1, "number of worker threads")
 var processID = flag.String("processID", "1", "An identifier to be able to recognize output from multiple processes")
 var jobsFile = flag.String("input_file", "", "File with puzzles/jobs")
 var outputDir = flag.String("output_dir", "", "Directory where output should go")
+var resplitJobs = flag.Int("resplit", 0, "Split the rest of jobs interrupted by -puzzle_timeout into this many new jobs and solve those too, 0 disables this")
+var resplitFirstJobID = flag.Int("resplit_first_job_id", 1000000000, "job_id of the first job created by -resplit, later jobs count up")
+var checkpointInterval = flag.Int("checkpoint_interval", 0, "Save the state of running jobs to a checkpoint file per worker every N seconds, 0 disables this")
+var checkpointNodes = flag.Uint("checkpoint_nodes", 0, "Save the state of running jobs to a checkpoint file per worker every N tiles placed, 0 disables this")
+var resumeCheckpoints = flag.Bool("resume_checkpoints", false, "Continue the jobs in the checkpoint files of this processID in output_dir before reading new input")
+var metricsAddress = flag.String("metrics_address", "", "Serve Prometheus metrics of the workers on http://[address]/metrics, like :9090, empty disables this")
+
+// subcommands replace solving when their name is the first argument, they parse the remaining arguments themselves
+var subcommands = map[string]func(args []string){
+	"split":       runSplit,
+	"resume":      runResume,
+	"verify":      runVerify,
+	"stats":       runStats,
+	"estimate":    runEstimate,
+	"coordinator": runCoordinator,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
-	//validate placementChoice:
-	if _, ok := tiling.PlacementOrderOptions[*placementChoice]; !ok {
-		log.Fatal("Couldn't recognize placement_choice.")
+	// the deferred cleanup of solve runs before the process exits
+	if err := solve(); err != nil {
+		log.Println("Exiting with an error:", err)
+		os.Exit(1)
+	}
+}
+
+// solve solves the jobs of the input the flags choose. It returns an error if it stopped reading the input early.
+func solve() error {
+	if err := solverOptions.Validate(); err != nil {
+		log.Fatal("Invalid solver options: ", err)
+	}
+	solver, ok := tiling.SolverOptions[*solverName]
+	if !ok {
+		log.Fatal("Couldn't recognize solver.")
+	}
+	if _, ok := solver.(tiling.ParallelSolver); ok {
+		solver = tiling.ParallelSolver{Workers: *searchWorkers}
 	}
 
 	//profiling cpu if cpuprofile is specified
@@ -69,7 +118,7 @@ func main() {
 
 	if *solverID <= 0 {
 		fmt.Println("No, or illegal, solver_id specified")
-		return
+		return nil
 	}
 	if *processTimeout == 0 {
 		*processTimeout = 3600 * 24 * 365 // a year in seconds, could be any big number
@@ -77,26 +126,69 @@ func main() {
 	if *puzzleTimeout == 0 {
 		*puzzleTimeout = 3600 * 24 * 365 // a year in seconds, could be any big number
 	}
-	optimizationFlags := make(map[int]bool)
-	optimizationFlags[tiling.FullSSNCheck] = *allSameSideNeighborCheck
-	optimizationFlags[tiling.OneLevelSSN] = *oneLevelSSNCheck
-	optimizationFlags[tiling.DoGapdetection] = *gapDetectionCheck
-	optimizationFlags[tiling.OneGapDetection] = *nextGapDetectionCheck
-	optimizationFlags[tiling.AllDownGapDetection] = *allDownDetectionCheck
-	optimizationFlags[tiling.LeftGapDetection] = *leftSideGapCheck
-	optimizationFlags[tiling.TotalGapAreaCheck] = *totalGapAreaCheck
-	optimizationFlags[tiling.ForceFrameUpright] = *forceFrameUpright
-
 	start := time.Now()
+	var solveErr error
 
+	if *jobsFile == "" && (*useDB || *coordinatorURL != "") {
+		// jobs are reserved when they are read, so jobs that are filtered out would stay reserved
+		if *numTiles > 0 || *puzzleIDs != "" || *jobIDs != "" || *boardWidths != "" || *boardHeights != "" || *skipPuzzles > 0 {
+			log.Fatal("Only -puzzle_limit can be used with -use_db or -coordinator")
+		}
+	}
 	if *jobsFile != "" {
-		taskReader := tileio.NewPuzzleCSVReader(*jobsFile)
+		inputOpts, closeRejects := readerOptions(*strictInput, *rejectFile)
+		defer closeRejects()
+		taskReader, err := tileio.NewPuzzleCSVReader(*jobsFile, inputOpts)
+		if err != nil {
+			log.Fatal("Could not open input file: ", err)
+		}
 		//TODO setup output stuff, for now print to output
 		//outputer
-		// solveTasks(taskReader, *solverID, *processTimeout, *puzzleTimeout, *stopOnSolution, *processID, *outputDir,
-		//*numSolvers, optimizationFlags, tiling.PlacementOrder[*placementChoice])
-		solveConcurrentTasks(taskReader, *solverID, *processTimeout, *puzzleTimeout, *stopOnSolution, *processID,
-			*outputDir, *numSolvers, optimizationFlags, tiling.PlacementOrderOptions[*placementChoice])
+		// solveTasks(taskReader, solver, *solverID, *processTimeout, *puzzleTimeout, *processID, *outputDir,
+		//*numSolvers, solverOptions)
+		solveErr = solveConcurrentTasks(taskReader, csvWriters(*outputDir, *processID), solver, *solverID,
+			*processTimeout, *puzzleTimeout, *processID, *outputDir, *numSolvers, solverOptions, *resplitJobs,
+			*resplitFirstJobID)
+	} else if *useDB {
+		// split and checkpointed jobs would only be in local files, while their rows in jobs are finished or taken over
+		if *resplitJobs > 0 || *resumeCheckpoints {
+			log.Fatal("-resplit and -resume_checkpoints can't be used with -use_db")
+		}
+		db, err := sql.Open("mysql", *dbstring)
+		if err != nil {
+			log.Fatal("Couldn't open database: ", err)
+		}
+		defer db.Close()
+		if err := tileio.CreatePuzzleTables(db); err != nil {
+			log.Fatal("Couldn't create database tables: ", err)
+		}
+		owner := fmt.Sprintf("solver %d process %s", *solverID, *processID)
+		expiry := time.Duration(*reservationExpiry) * time.Second
+		taskReader := tileio.NewPuzzleDBReader(db, *batchSize, owner, expiry)
+		// jobs reserved but not started when the process stops go back to the other solvers
+		defer func() {
+			if err := taskReader.Close(); err != nil {
+				log.Println("Couldn't release reserved jobs: ", err)
+			}
+		}()
+		// all workers share the database writer, it renews the reservations while they run
+		resolutionWriter := tileio.NewPuzzleDBWriter(db, owner, expiry)
+		newWriter := func(worker int) (tileio.PuzzleResolutionWriter, error) { return resolutionWriter, nil }
+		solveErr = solveConcurrentTasks(taskReader, newWriter, solver, *solverID, *processTimeout, *puzzleTimeout,
+			*processID, *outputDir, *numSolvers, solverOptions, 0, *resplitFirstJobID)
+	} else if *coordinatorURL != "" {
+		// the coordinator only knows the jobs it handed out
+		if *resplitJobs > 0 || *resumeCheckpoints {
+			log.Fatal("-resplit and -resume_checkpoints can't be used with -coordinator")
+		}
+		hostname, _ := os.Hostname()
+		owner := fmt.Sprintf("%s solver %d process %s", hostname, *solverID, *processID)
+		client := tileio.NewCoordinatorClient(*coordinatorURL, owner, *batchSize)
+		defer client.Close()
+		// all workers share the client, it reports their results with their leases
+		newWriter := func(worker int) (tileio.PuzzleResolutionWriter, error) { return client, nil }
+		solveErr = solveConcurrentTasks(client, newWriter, solver, *solverID, *processTimeout, *puzzleTimeout,
+			*processID, *outputDir, *numSolvers, solverOptions, 0, *resplitFirstJobID)
 	}
 	// fmt.Print(len(solveAsQas8()))
 	// fmt.Println(len(solveTestCase()))
@@ -116,99 +208,254 @@ func main() {
 		}
 		f.Close()
 	}
+	return solveErr
 }
 
-func solveConcurrentTasks(tasks tileio.PuzzleReader, solverID int, processTimeout int, puzzleTimeout int, stopOnSolution bool,
-	processID string, outputDir string, workers int, optimizations map[int]bool, placementOrder int) {
+// solveConcurrentTasks solves tasks with a number of workers, each writing to the output newWriter opens for it.
+// If resplitJobs > 0, jobs interrupted by the puzzle timeout are split into resplitJobs new jobs which are queued,
+// these get job ids counting up from resplitFirstJobID.
+// It returns an error if it stopped reading tasks because of one, after the running jobs finished.
+func solveConcurrentTasks(tasks tileio.PuzzleReader, newWriter func(worker int) (tileio.PuzzleResolutionWriter, error),
+	solver tiling.Solver, solverID int, processTimeout int, puzzleTimeout int, processID string, outputDir string,
+	workers int, opts tiling.Options, resplitJobs int, resplitFirstJobID int) error {
 	// parse options, determine endtime
 	puzzlesSolved := 0
 	activeWorkers := 0
 	processEndTime := time.Now().Add(time.Duration(1000000000 * int64(processTimeout)))
+	// cancelling ctx interrupts all workers, they will save their current state and return
+	ctx, cancel := context.WithDeadline(context.Background(), processEndTime)
+	defer cancel()
+	stopSignals := cancelOnSignal(cancel)
+	defer stopSignals()
+	// readers that wait for new jobs stop waiting once the workers are interrupted
+	if interruptible, ok := tasks.(interface{ Interrupt() }); ok {
+		go func() {
+			<-ctx.Done()
+			interruptible.Interrupt()
+		}()
+	}
+	tasks = filterTasks(tasks)
 
-	// for i in workers create and start worker
-	fileWriters := make([]tileio.PuzzleResolutionWriter, workers)
-	finishedJobsChan := make(chan int, workers) //one buffered channel of len workers
-	// interrupter := make(chan string, 1) //all workers will receive the same interrupt
-
-	for worker := 0; worker < workers; worker++ {
-		//open files
-		var err error
-		statusFile := fmt.Sprintf("%s/%s_%d.status.csv", outputDir, processID, worker) //TODO zero pad worker
-		solutionsFile := fmt.Sprintf("%s/%s_%d.solutions.csv", outputDir, processID, worker)
-		fmt.Println(statusFile, solutionsFile)
-		fileWriters[worker], err = tileio.NewPuzzleCSVWriter(statusFile, solutionsFile)
+	var metrics *processMetrics
+	if *metricsAddress != "" {
+		metrics = newProcessMetrics(workers, processEndTime)
+		server, err := serveMetrics(*metricsAddress, metrics)
 		if err != nil {
-			log.Fatal("Could not open logging files: ", err)
+			log.Fatal("Couldn't serve metrics: ", err)
 		}
-		//get puzzle
-		puzzle, err := tasks.NextPuzzle()
+		defer server.Close()
+	}
+
+	// jobs split from interrupted jobs are solved before new tasks are read
+	queue := newJobQueue(tasks, fmt.Sprintf("%s/%s.jobs.csv", outputDir, processID), resplitFirstJobID)
+	defer queue.Close()
+	// jobs that were running when an earlier run of this process died go first
+	if *resumeCheckpoints {
+		err := queue.requeueCheckpoints(fmt.Sprintf("%s/%s_*.checkpoint.json", outputDir, processID),
+			fmt.Sprintf("%s/%s_*.solutions.csv", outputDir, processID))
 		if err != nil {
-			//TODO handle error
-			log.Println("Couldn't read puzzle, assuming EOF:", err)
-			break
+			log.Fatal("Couldn't continue from checkpoints: ", err)
 		}
-		go runWorker(finishedJobsChan, worker, solverID, puzzle, puzzleTimeout, processEndTime,
-			stopOnSolution, fileWriters[worker], optimizations, placementOrder)
-		activeWorkers++
 	}
 
-	//loop and wait around
-	for activeWorkers > 0 {
-		//if receive signal from worker
-		//get resolutionWriter back from workerFunc (or its id perhaps)
-		log.Println("ActiveWorkers: ", activeWorkers)
-		select {
-		case worker := <-finishedJobsChan:
-			puzzlesSolved++
-			activeWorkers--
-			log.Println("Finished puzzle on ", worker, activeWorkers)
-
-			if time.Now().Before(processEndTime) {
-				//start new worker
-				puzzle, err := tasks.NextPuzzle()
+	// for i in workers create and start worker
+	fileWriters := make([]tileio.PuzzleResolutionWriter, workers)
+	finishedJobsChan := make(chan finishedJob, workers) //one buffered channel of len workers
+	idleWorkers := make([]int, workers)
+	for worker := range idleWorkers {
+		idleWorkers[worker] = workers - 1 - worker //so worker 0 is started first
+	}
+
+	//startIdleWorkers gives every idle worker a new job, as long as there are jobs and no job failed
+	var inputErr, jobErr error
+	startIdleWorkers := func() {
+		for len(idleWorkers) > 0 && ctx.Err() == nil && inputErr == nil && jobErr == nil {
+			puzzle, err := queue.NextPuzzle()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				// the running jobs still finish
+				log.Println("Couldn't read puzzle:", err)
+				inputErr = err
+				return
+			}
+			worker := idleWorkers[len(idleWorkers)-1]
+			idleWorkers = idleWorkers[:len(idleWorkers)-1]
+			if fileWriters[worker] == nil {
+				fileWriters[worker], err = newWriter(worker)
 				if err != nil {
-					//TODO handle error
-					log.Println("Couldn't read puzzle:", err)
-					fileWriters[worker].Close()
-					continue
+					log.Fatal("Could not open logging files: ", err)
 				}
-				go runWorker(finishedJobsChan, worker, solverID, puzzle, puzzleTimeout, processEndTime, stopOnSolution,
-					fileWriters[worker], optimizations, placementOrder)
-				activeWorkers++
-				log.Println("Started puzzle ", puzzle.JobID, " on worker ", worker)
-
 			}
-			//case interrupt
+			checkpointFile := ""
+			if *checkpointInterval > 0 || *checkpointNodes > 0 {
+				checkpointFile = fmt.Sprintf("%s/%s_%d.checkpoint.json", outputDir, processID, worker)
+			}
+			metrics.startJob(worker, puzzle.JobID, puzzle.PuzzleID)
+			go runWorker(ctx, finishedJobsChan, worker, solver, solverID, puzzle, puzzleTimeout, fileWriters[worker], opts,
+				queue, resplitJobs, checkpointFile, metrics)
+			activeWorkers++
+			log.Println("Started puzzle ", puzzle.JobID, " on worker ", worker)
+		}
+	}
+	startIdleWorkers()
+
+	//loop and wait around
+	for activeWorkers > 0 {
+		log.Println("ActiveWorkers: ", activeWorkers)
+		finished := <-finishedJobsChan
+		worker := finished.worker
+		if finished.err != nil && jobErr == nil {
+			// the output can't be trusted anymore, the running jobs still finish
+			log.Println("Not starting new jobs after job", finished.jobID, "failed")
+			jobErr = fmt.Errorf("job %d failed: %v", finished.jobID, finished.err)
+		}
+		puzzlesSolved++
+		activeWorkers--
+		log.Println("Finished puzzle on ", worker, activeWorkers)
+		//the finished job could have queued new jobs, so all idle workers get a chance to start again
+		idleWorkers = append(idleWorkers, worker)
+		startIdleWorkers()
+	}
+	for _, fileWriter := range fileWriters {
+		if fileWriter != nil {
+			fileWriter.Close()
 		}
 	}
 	log.Println("Finished puzzleSolving, with", puzzlesSolved, "done  ")
 	log.Println(processEndTime.Sub(time.Now()).String(), "before end time")
+	if inputErr != nil {
+		return fmt.Errorf("stopped reading input: %v", inputErr)
+	}
+	return jobErr
+}
+
+// readerOptions returns the options of the input readers for -strict_input and -reject_file, and a function that
+// closes the reject file
+func readerOptions(strict bool, rejectFile string) (tileio.ReaderOptions, func()) {
+	opts := tileio.ReaderOptions{Strict: strict}
+	if rejectFile == "" {
+		return opts, func() {}
+	}
+	file, err := os.Create(rejectFile)
+	if err != nil {
+		log.Fatal("Could not open reject file: ", err)
+	}
+	opts.Rejects = tileio.NewRejectWriter(file)
+	return opts, func() { file.Close() }
 }
 
-func runWorker(out chan int, workerID int, solverID int, puzzle tileio.PuzzleDescription, puzzleTimeout int, processEndTime time.Time,
-	stopOnSolution bool, resolutionWriter tileio.PuzzleResolutionWriter, optimizations map[int]bool, placementOrder int) {
+// csvWriters returns a function that opens the status and solutions files of a worker in outputDir
+func csvWriters(outputDir string, processID string) func(worker int) (tileio.PuzzleResolutionWriter, error) {
+	return func(worker int) (tileio.PuzzleResolutionWriter, error) {
+		statusFile := fmt.Sprintf("%s/%s_%d.status.csv", outputDir, processID, worker) //TODO zero pad worker
+		solutionsFile := fmt.Sprintf("%s/%s_%d.solutions.csv", outputDir, processID, worker)
+		fmt.Println(statusFile, solutionsFile)
+		return tileio.NewPuzzleCSVWriter(statusFile, solutionsFile)
+	}
+}
+
+// finishedJob is what runWorker reports when it is done, err is set if the solutions or the status of the job
+// couldn't be written
+type finishedJob struct {
+	worker int
+	jobID  int
+	err    error
+}
+
+// runWorker solves a single puzzle and reports on out when done.
+// The puzzle is interrupted when ctx is cancelled or after puzzleTimeout seconds, whichever comes first.
+// If only the puzzle timed out and resplitJobs > 0, the rest of the job is split and queued, and gets status "split".
+// A job that stopped because of an error isn't split, the error is reported on out.
+// If checkpointFile is set the state of the job is saved there regularly, and removed when the job ends.
+// If resolutionWriter is a tileio.ProgressWriter it gets the state of the job as often as it asks for.
+// metrics, if not nil, follows the progress of the job.
+func runWorker(ctx context.Context, out chan finishedJob, workerID int, solver tiling.Solver, solverID int, puzzle tileio.PuzzleDescription, puzzleTimeout int,
+	resolutionWriter tileio.PuzzleResolutionWriter, opts tiling.Options, queue *jobQueue, resplitJobs int, checkpointFile string,
+	metrics *processMetrics) {
 	solveStart := time.Now()
-	solveEnd := solveStart.Add(time.Duration(1000000000 * int64(puzzleTimeout)))
-	if processEndTime.Before(solveEnd) {
-		solveEnd = processEndTime
+	puzzleCtx, cancel := context.WithTimeout(ctx, time.Duration(1000000000*int64(puzzleTimeout)))
+	defer cancel()
+	tilesPlacedBefore := queue.tilesPlacedBefore(&puzzle)
+	progress := tiling.Progress{}
+	if checkpointFile != "" {
+		progress = tiling.Progress{
+			Nodes:    *checkpointNodes,
+			Interval: time.Duration(*checkpointInterval) * time.Second,
+			Report: func(currentState []core.TilePlacement, tilesPlaced uint) {
+				checkpoint := tileio.NewCheckpoint(&puzzle, currentState, tilesPlacedBefore+tilesPlaced)
+				if err := tileio.SaveCheckpoint(checkpointFile, &checkpoint); err != nil {
+					log.Println("Couldn't save checkpoint of job", puzzle.JobID, err)
+				}
+			},
+		}
+	}
+	if progressWriter, ok := resolutionWriter.(tileio.ProgressWriter); ok {
+		progress = combineProgress(progress, tiling.Progress{
+			Interval: progressWriter.ProgressInterval(),
+			Report: func(currentState []core.TilePlacement, tilesPlaced uint) {
+				if err := progressWriter.SaveProgress(&puzzle, currentState, tilesPlaced); err != nil {
+					log.Println("Couldn't save progress of job", puzzle.JobID, err)
+				}
+			},
+		})
+	}
+	progress = metrics.progress(workerID, progress)
+	sink := solutionWriterSink(resolutionWriter, &puzzle, queue.savedSolutionsOf(&puzzle))
+	solutionsCounted := 0
+	if metrics != nil {
+		writeSolution := sink
+		sink = func(solution []tiling.Tile) error {
+			solutionsCounted++
+			metrics.addSolutions(1)
+			return writeSolution(solution)
+		}
+	}
+	result, err := solver.Solve(puzzleCtx, puzzle.Puzzle(), opts, sink, progress)
+	if err != nil {
+		log.Println("Error while solving job", puzzle.JobID, err)
+	}
+	if result.Solutions > solutionsCounted { // with -count_only the sink isn't called
+		metrics.addSolutions(uint(result.Solutions - solutionsCounted))
+	}
+	tilesPlacedNow := result.TilesPlaced
+	result.TilesPlaced += tilesPlacedBefore
+	// only the puzzle timeout is a reason to split, not the end of the process or an error of the sink
+	if result.Status == "interrupted" && resplitJobs > 0 && err == nil && ctx.Err() == nil && puzzleCtx.Err() != nil {
+		if queue.resplit(ctx, &puzzle, result.CurrentState, opts, resplitJobs) {
+			result.Status = "split"
+		}
 	}
-	solutions, status, tilesPlaced, currentPlacement := tiling.SolveNaive(puzzle.Board, *puzzle.Tiles, *puzzle.Start,
-		*puzzle.End, solveEnd, stopOnSolution, optimizations, placementOrder)
 	solveTime := time.Since(solveStart)
-	resolutionWriter.SaveSolutions(puzzle.PuzzleID, puzzle.JobID, &solutions)
-	resolutionWriter.SaveStatus(&puzzle, status, tilesPlaced, solveTime, solverID, &currentPlacement)
+	if statusErr := resolutionWriter.SaveStatus(&puzzle, jobStatus(&result, solveTime, solverID, opts)); statusErr != nil {
+		log.Println("Couldn't save status of job", puzzle.JobID, statusErr)
+		if err == nil {
+			err = statusErr
+		}
+	}
+	if checkpointFile != "" {
+		// the status row has the final state, so the checkpoint would only repeat work
+		os.Remove(checkpointFile)
+	}
+	metrics.finishJob(workerID, result.Status, tilesPlacedNow)
 
 	log.Println("finished solving job ", puzzle.JobID, "on worker", workerID, " in ", solveTime)
-	log.Println(len(solutions), "solutions found for puzzle ", puzzle.PuzzleID)
-	out <- workerID
+	log.Println(result.Solutions, "solutions found for puzzle ", puzzle.PuzzleID)
+	out <- finishedJob{worker: workerID, jobID: puzzle.JobID, err: err}
 	return
 }
 
-func solveTasks(tasks tileio.PuzzleReader, solverID int, processTimeout int, puzzleTimeout int, stopOnSolution bool,
-	processID string, outputDir string, workers int, optimizationFlags map[int]bool, placementOrder int) {
+func solveTasks(tasks tileio.PuzzleReader, solver tiling.Solver, solverID int, processTimeout int, puzzleTimeout int,
+	processID string, outputDir string, workers int, opts tiling.Options) {
 	log.Println("starting solveTasks", solverID, workers)
+	tasks = filterTasks(tasks)
 	puzzlesSolved := 0
 	processEndTime := time.Now().Add(time.Duration(1000000000 * int64(processTimeout)))
+	ctx, cancel := context.WithDeadline(context.Background(), processEndTime)
+	defer cancel()
+	stopSignals := cancelOnSignal(cancel)
+	defer stopSignals()
 
 	var resolutionWriter tileio.PuzzleResolutionWriter
 	var err error
@@ -221,26 +468,26 @@ func solveTasks(tasks tileio.PuzzleReader, solverID int, processTimeout int, puz
 		log.Println("Could not open logging files: ", err)
 	}
 
-	for puzzle, err := tasks.NextPuzzle(); err != io.EOF; puzzle, err = tasks.NextPuzzle() {
+	for puzzle, err := tasks.NextPuzzle(); err != io.EOF && ctx.Err() == nil; puzzle, err = tasks.NextPuzzle() {
 		if err != nil {
 			log.Println(err)
 			return
 		}
 		log.Println("start solving job", puzzle.JobID)
 		solveStart := time.Now()
-		solveEnd := solveStart.Add(time.Duration(1000000000 * int64(puzzleTimeout)))
-		if processEndTime.Before(solveEnd) {
-			solveEnd = processEndTime
+		puzzleCtx, cancelPuzzle := context.WithTimeout(ctx, time.Duration(1000000000*int64(puzzleTimeout)))
+		result, err := solver.Solve(puzzleCtx, puzzle.Puzzle(), opts, solutionWriterSink(resolutionWriter, &puzzle, nil),
+			tiling.Progress{})
+		cancelPuzzle()
+		if err != nil {
+			log.Println("Error while solving job", puzzle.JobID, err)
 		}
-		solutions, status, tilesPlaced, currentPlacement := tiling.SolveNaive(puzzle.Board, *puzzle.Tiles, *puzzle.Start,
-			*puzzle.End, solveEnd, stopOnSolution, optimizationFlags, placementOrder)
 		solveTime := time.Since(solveStart)
 
-		resolutionWriter.SaveSolutions(puzzle.PuzzleID, puzzle.JobID, &solutions)
-		resolutionWriter.SaveStatus(&puzzle, status, tilesPlaced, solveTime, solverID, &currentPlacement)
+		resolutionWriter.SaveStatus(&puzzle, jobStatus(&result, solveTime, solverID, opts))
 
 		log.Println("finished solving job ", puzzle.JobID, " in ", solveTime)
-		log.Println(len(solutions), "solutions found for puzzle ", puzzle.PuzzleID)
+		log.Println(result.Solutions, "solutions found for puzzle ", puzzle.PuzzleID)
 		puzzlesSolved++
 		// log.Fatal("quiting early")
 	}
@@ -248,31 +495,87 @@ func solveTasks(tasks tileio.PuzzleReader, solverID int, processTimeout int, puz
 	log.Println("finished, solved ", puzzlesSolved, " puzzles")
 }
 
-// func startTask(w *resolutionWriter) {
+// filterTasks applies the input filters -num_tiles, -puzzle_ids, -job_ids, -board_widths and -board_heights to tasks,
+// then skips the first -skip puzzles and stops after -puzzle_limit
+func filterTasks(tasks tileio.PuzzleReader) tileio.PuzzleReader {
+	var filters []tileio.PuzzleFilter
+	if *numTiles > 0 {
+		filters = append(filters, tileio.NumTilesFilter(*numTiles))
+	}
+	for _, rangeFlag := range []struct {
+		name, value string
+		filter      func(tileio.Ranges) tileio.PuzzleFilter
+	}{
+		{"puzzle_ids", *puzzleIDs, tileio.PuzzleIDFilter},
+		{"job_ids", *jobIDs, tileio.JobIDFilter},
+		{"board_widths", *boardWidths, tileio.BoardWidthFilter},
+		{"board_heights", *boardHeights, tileio.BoardHeightFilter},
+	} {
+		if rangeFlag.value == "" {
+			continue
+		}
+		ranges, err := tileio.ParseRanges(rangeFlag.value)
+		if err != nil {
+			log.Fatal("Invalid -", rangeFlag.name, ": ", err)
+		}
+		filters = append(filters, rangeFlag.filter(ranges))
+	}
+	tasks = tileio.NewSkipReader(tileio.NewFilterReader(tasks, filters...), *skipPuzzles)
+	if *puzzleLimit > 0 {
+		tasks = tileio.NewLimitReader(tasks, *puzzleLimit)
+	}
+	return tasks
+}
 
-// }
+// solutionWriterSink returns a sink that appends every solution of puzzle to w as soon as it is found, except the
+// solutions with a hash in saved
+func solutionWriterSink(w tileio.PuzzleResolutionWriter, puzzle *tileio.PuzzleDescription,
+	saved map[string]bool) tiling.SolutionSink {
+	return func(solution []tiling.Tile) error {
+		tiles := tiling.TileSliceToJSON(solution)
+		if saved != nil && saved[tileio.SolutionHash(tiles)] {
+			return nil
+		}
+		return w.SaveSolution(puzzle.PuzzleID, puzzle.JobID, tiles)
+	}
+}
 
-func getDefaultOptimizations() map[int]bool {
-	optimizations := map[int]bool{
-		tiling.FullSSNCheck:        true,
-		tiling.OneLevelSSN:         false,
-		tiling.DoGapdetection:      true,
-		tiling.OneGapDetection:     false,
-		tiling.AllDownGapDetection: true,
-		tiling.LeftGapDetection:    true,
-		tiling.TotalGapAreaCheck:   true,
-		tiling.ForceFrameUpright:   true,
-	}
-	return optimizations
+// jobStatus converts the result of a solver to a row for the status output
+func jobStatus(result *tiling.Result, solveTime time.Duration, solverID int, opts tiling.Options) *tileio.JobStatus {
+	stats := ""
+	if result.Stats != nil {
+		encoded, err := json.Marshal(result.Stats)
+		if err != nil {
+			log.Println("Couldn't encode search stats: ", err)
+		}
+		stats = string(encoded)
+	}
+	return &tileio.JobStatus{
+		Status:       result.Status,
+		TilesPlaced:  result.TilesPlaced,
+		Duration:     solveTime,
+		SolverID:     solverID,
+		CurrentState: result.CurrentState,
+		Solver:       *solverName,
+		Options:      opts.String(),
+		Solutions:    result.Solutions,
+		CornerCounts: result.CornerCounts,
+		Stats:        stats,
+		Reason:       result.Reason,
+	}
 }
 
+// func startTask(w *resolutionWriter) {
+
+// }
+
 func solveTestCase() map[string]int {
 	board := core.Coord{X: 41, Y: 25}
 	tiles := make([]core.Coord, 11)
 	tileBytes := []byte("[{\"X\":22,\"Y\":14},{\"X\":20,\"Y\":6},{\"X\":20,\"Y\":3},{\"X\":20,\"Y\":2},{\"X\":17,\"Y\":1},{\"X\":15,\"Y\":11},{\"X\":14,\"Y\":13},{\"X\":10,\"Y\":5},{\"X\":7,\"Y\":6},{\"X\":7,\"Y\":5},{\"X\":6,\"Y\":1}]")
 	json.Unmarshal(tileBytes, &tiles)
 	result, _, _, _ := tiling.SolveNaive(board, tiles, nil, nil, time.Now().Add(time.Duration(1000000000*3600)),
-		false, getDefaultOptimizations(), tiling.LastGapFirst)
+		tiling.DefaultOptions())
 	return result
 }
 
@@ -283,7 +586,7 @@ func solveAsQas3() map[string]int {
 		tiles[2-i] = core.Coord{X: i + 2, Y: i + 1}
 	}
 	result, _, _, _ := tiling.SolveNaive(core.Coord{X: 5, Y: 4}, tiles[:], nil, nil,
-		time.Now().Add(time.Duration(1000000000*3600)), false, getDefaultOptimizations(), tiling.LastGapFirst)
+		time.Now().Add(time.Duration(1000000000*3600)), tiling.DefaultOptions())
 	return result
 }
 
@@ -294,7 +597,7 @@ func solveAsQas8() map[string]int {
 		tiles[7-i] = core.Coord{X: i + 2, Y: i + 1}
 	}
 	result, _, steps, _ := tiling.SolveNaive(core.Coord{X: 15, Y: 16}, tiles[:], nil, nil,
-		time.Now().Add(time.Duration(1000000000*3600)), false, getDefaultOptimizations(), tiling.LastGapFirst)
+		time.Now().Add(time.Duration(1000000000*3600)), tiling.DefaultOptions())
 	fmt.Println("steps", steps)
 	return result
 }
@@ -305,8 +608,10 @@ func solveAsQas20() map[string]int {
 	for i := range tiles {
 		tiles[19-i] = core.Coord{X: i + 2, Y: i + 1}
 	}
+	opts := tiling.DefaultOptions()
+	opts.StopOnSolution = true
 	results, _, steps, _ := tiling.SolveNaive(core.Coord{X: 55, Y: 56}, tiles[:], nil, nil,
-		time.Now().Add(time.Duration(1000000000*3600)), true, getDefaultOptimizations(), tiling.LastGapFirst)
+		time.Now().Add(time.Duration(1000000000*3600)), opts)
 	fmt.Println("steps", steps)
 	return results
 }
@@ -315,15 +620,19 @@ func solveFromFile(filePath *string) {
 	pathParts := strings.Split(*filePath, ".")
 	extension := pathParts[len(pathParts)-1]
 	var reader tileio.PuzzleReader
+	var err error
 	if extension == "json" {
-		reader = tileio.NewPuzzleJSONReader(*filePath)
+		reader, err = tileio.NewPuzzleJSONReader(*filePath, tileio.ReaderOptions{})
 	} else if extension == "csv" {
-		reader = tileio.NewPuzzleCSVReader(*filePath)
+		reader, err = tileio.NewPuzzleCSVReader(*filePath, tileio.ReaderOptions{})
+	}
+	if err != nil {
+		log.Fatal("Could not open input file: ", err)
 	}
 
 	for puzzle, err := reader.NextPuzzle(); err == nil; puzzle, err = reader.NextPuzzle() {
 		solutions, _, _, _ := tiling.SolveNaive(puzzle.Board, *puzzle.Tiles, nil, nil,
-			time.Now().Add(time.Duration(1000000000*3600)), false, getDefaultOptimizations(), tiling.LastGapFirst)
+			time.Now().Add(time.Duration(1000000000*3600)), tiling.DefaultOptions())
 		log.Println("solved a puzzle")
 		for _, solution := range solutions {
 			//TODO write solutions
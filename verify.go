@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"localhost/flobrm/tilingsolver/core"
+	"localhost/flobrm/tilingsolver/tileio"
+	"localhost/flobrm/tilingsolver/tiling"
+	"log"
+	"os"
+	"strings"
+)
+
+// runVerify implements the verify subcommand. It checks every row of the solutions files against the puzzle it
+// belongs to, and prints the violations of each invalid row. It exits with status 1 if any row is invalid.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	inputFiles := fs.String("input_file", "", "Comma separated files with the puzzles/jobs that were solved")
+	solutionsFiles := fs.String("solutions_files", "", "Comma separated solutions files or glob patterns, like output/*.solutions.csv")
+	fs.Parse(args)
+
+	if *inputFiles == "" || *solutionsFiles == "" {
+		log.Fatal("verify needs an -input_file and -solutions_files")
+	}
+
+	puzzles := make(map[int]core.Puzzle)
+	for _, inputFile := range strings.Split(*inputFiles, ",") {
+		reader, err := tileio.NewPuzzleCSVReader(inputFile, tileio.ReaderOptions{})
+		if err != nil {
+			log.Fatal("Could not open input file: ", err)
+		}
+		for job, err := reader.NextPuzzle(); err != io.EOF; job, err = reader.NextPuzzle() {
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, ok := puzzles[job.PuzzleID]; !ok {
+				puzzles[job.PuzzleID] = job.Puzzle()
+			}
+		}
+	}
+	paths, err := expandGlobs(*solutionsFiles)
+	if err != nil {
+		log.Fatal("Invalid solutions files: ", err)
+	}
+
+	var rows, invalid int
+	for _, path := range paths {
+		reader, err := tileio.NewSolutionCSVReader(path)
+		if err != nil {
+			log.Fatal("Couldn't read solutions file: ", err)
+		}
+		for {
+			solution, err := reader.NextSolution()
+			if err == io.EOF {
+				break
+			}
+			rows++
+			var violations []error
+			if err != nil {
+				violations = []error{err}
+			} else {
+				violations = verifySolutionRecord(&solution, puzzles)
+			}
+			if len(violations) > 0 {
+				invalid++
+				for _, violation := range violations {
+					fmt.Printf("%s:%d puzzle %d job %d: %v\n", path, solution.LineNumber, solution.PuzzleID, solution.JobID,
+						violation)
+				}
+			}
+		}
+		reader.Close()
+	}
+	log.Println("verify:", rows, "solutions checked,", invalid, "invalid")
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// verifySolutionRecord returns the violations of one row of a solutions file, including a tiles_hash that doesn't match
+func verifySolutionRecord(solution *tileio.SolutionRecord, puzzles map[int]core.Puzzle) []error {
+	var violations []error
+	if hash := tileio.SolutionHash(solution.Tiles); hash != solution.TilesHash {
+		violations = append(violations, fmt.Errorf("tiles_hash is %s, the tiles hash to %s", solution.TilesHash, hash))
+	}
+	puzzle, ok := puzzles[solution.PuzzleID]
+	if !ok {
+		return append(violations, fmt.Errorf("puzzle %d isn't in the input", solution.PuzzleID))
+	}
+	var tiles []tiling.Tile
+	if err := json.Unmarshal([]byte(solution.Tiles), &tiles); err != nil {
+		return append(violations, fmt.Errorf("invalid tiles: %v", err))
+	}
+	return append(violations, tiling.VerifyPuzzleSolution(puzzle, tiles)...)
+}